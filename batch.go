@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/betorvs/sensu-grafana-mutator/mutator"
+	"github.com/sensu-community/sensu-plugin-sdk/sensu"
+	"github.com/sensu/sensu-go/types"
+)
+
+// batchSummary counts links created and errors found for each rule: the dashboard rule before rendering
+// templates or the link provider name
+type batchSummary struct {
+	Events   int
+	Mutated  int
+	Failed   int
+	Links    map[string]int
+	Errors   map[string]int
+	Failures []string
+}
+
+// batchCommand runs sensu-grafana-mutator batch [file], it reads a json list or
+// a stream of json events (ndjson) from file or stdin and writes mutated events as ndjson
+func batchCommand(input string) {
+	batch := sensu.NewGoCheck(&mutatorConfig.PluginConfig, options, checkBatchArgs, func(_ *types.Event) (int, error) {
+		return executeBatch(input)
+	}, false)
+	batch.Execute()
+}
+
+// batchInput returns the first positional argument as input file and all other arguments.
+// Values of flags that are not bool, like --grafana-url https://grafana.com, are not positional arguments.
+func batchInput(args []string) (string, []string) {
+	input := ""
+	rest := []string{}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			if input == "" && i+1 < len(args) {
+				input = args[i+1]
+				i++
+			}
+			rest = append(rest, args[i+1:]...)
+			return input, rest
+		case arg != "-" && strings.HasPrefix(arg, "-"):
+			rest = append(rest, arg)
+			if !strings.Contains(arg, "=") && flagNeedsValue(strings.TrimLeft(arg, "-")) && i+1 < len(args) {
+				rest = append(rest, args[i+1])
+				i++
+			}
+		case input == "":
+			input = arg
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	return input, rest
+}
+
+// flagNeedsValue returns true if name is a long or shorthand flag in options without bool value
+func flagNeedsValue(name string) bool {
+	for _, opt := range options {
+		if opt.Argument != name && (opt.Shorthand == "" || opt.Shorthand != name) {
+			continue
+		}
+		_, isBool := opt.Value.(*bool)
+		return !isBool
+	}
+	return false
+}
+
+func checkBatchArgs(_ *types.Event) (int, error) {
+	if err := checkArgs(nil); err != nil {
+		return sensu.CheckStateUnknown, err
+	}
+	return sensu.CheckStateOK, nil
+}
+
+// executeBatch writes mutated events to stdout and the summary to stderr
+func executeBatch(input string) (int, error) {
+	reader := os.Stdin
+	if input != "" && input != "-" {
+		file, err := os.Open(input)
+		if err != nil {
+			return sensu.CheckStateUnknown, err
+		}
+		defer file.Close()
+		reader = file
+	}
+	out := bufio.NewWriter(os.Stdout)
+	summary, err := runBatch(reader, out)
+	if flushErr := out.Flush(); err == nil {
+		err = flushErr
+	}
+	summary.write(os.Stderr)
+	if err != nil {
+		return sensu.CheckStateUnknown, err
+	}
+	if summary.Failed != 0 {
+		return sensu.CheckStateWarning, nil
+	}
+	return sensu.CheckStateOK, nil
+}
+
+// runBatch mutates each event found in r and writes it as one json line in out
+func runBatch(r io.Reader, out io.Writer) (batchSummary, error) {
+	summary := batchSummary{
+		Links:  make(map[string]int),
+		Errors: make(map[string]int),
+	}
+	encoder := json.NewEncoder(out)
+	err := readEvents(r, func(raw json.RawMessage) error {
+		summary.Events++
+		event := &types.Event{}
+		if err := json.Unmarshal(raw, event); err != nil {
+			summary.fail(fmt.Sprintf("event %d: %v", summary.Events, err))
+			return nil
+		}
+		if err := validateEvent(event); err != nil {
+			summary.fail(fmt.Sprintf("event %d: %v", summary.Events, err))
+			return nil
+		}
+		mutated, err := summary.mutate(event)
+		if err != nil {
+			summary.fail(fmt.Sprintf("event %d (%s/%s): %v", summary.Events, event.Entity.Name, event.Check.Name, err))
+			return nil
+		}
+		summary.Mutated++
+		return encoder.Encode(mutated)
+	})
+	return summary, err
+}
+
+// readEvents calls fn for each event in a json list or in a stream of json objects
+func readEvents(r io.Reader, fn func(json.RawMessage) error) error {
+	buffered := bufio.NewReader(r)
+	first, err := peekNonSpace(buffered)
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(buffered)
+	if first == '[' {
+		if _, err := decoder.Token(); err != nil {
+			return err
+		}
+	}
+	for decoder.More() {
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			return err
+		}
+		if err := fn(raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func peekNonSpace(r *bufio.Reader) (byte, error) {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if !strings.ContainsRune(" \t\r\n", rune(b)) {
+			return b, r.UnreadByte()
+		}
+	}
+}
+
+func (s *batchSummary) fail(reason string) {
+	s.Failed++
+	s.Failures = append(s.Failures, reason)
+}
+
+// mutate works like mutateEvent and counts links created and link errors by rule. Rendered annotation
+// names are not used because dashboard rules using templates create one name for each label value
+func (s *batchSummary) mutate(event *types.Event) (*types.Event, error) {
+	m, err := eventMutator(event)
+	if err != nil {
+		return nil, err
+	}
+	// events without check are returned or rejected by Mutate
+	if event.Check == nil {
+		return m.Mutate(event)
+	}
+	links, err := m.Links(event)
+	linkErrors, _ := err.(mutator.LinkErrors)
+	s.count(links, linkErrors)
+	return m.AddLinks(event, links, err), nil
+}
+
+// count adds links created and link errors by rule
+func (s *batchSummary) count(links []mutator.Link, linkErrors mutator.LinkErrors) {
+	for _, link := range links {
+		s.Links[link.Rule]++
+	}
+	for _, e := range linkErrors {
+		s.Errors[e.Rule]++
+	}
+}
+
+func (s batchSummary) write(w io.Writer) {
+	fmt.Fprintf(w, "events: %d mutated: %d failed: %d\n", s.Events, s.Mutated, s.Failed)
+	names := []string{}
+	for k := range s.Links {
+		names = append(names, k)
+	}
+	for k := range s.Errors {
+		if _, ok := s.Links[k]; !ok {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+	if len(names) != 0 {
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "RULE\tLINKS\tERRORS")
+		for _, name := range names {
+			fmt.Fprintf(tw, "%s\t%d\t%d\n", name, s.Links[name], s.Errors[name])
+		}
+		tw.Flush()
+	}
+	for _, f := range s.Failures {
+		fmt.Fprintf(w, "failed %s\n", f)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	v2 "github.com/sensu/sensu-go/api/core/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadEvents(t *testing.T) {
+	count := func(input string) (int, error) {
+		n := 0
+		err := readEvents(strings.NewReader(input), func(raw json.RawMessage) error {
+			n++
+			return nil
+		})
+		return n, err
+	}
+	n1, err1 := count(`[{"timestamp":1},{"timestamp":2}]`)
+	assert.NoError(t, err1)
+	assert.Equal(t, 2, n1)
+	n2, err2 := count("{\"timestamp\":1}\n{\"timestamp\":2}\n{\"timestamp\":3}\n")
+	assert.NoError(t, err2)
+	assert.Equal(t, 3, n2)
+	n3, err3 := count("  \n")
+	assert.NoError(t, err3)
+	assert.Equal(t, 0, n3)
+	_, err4 := count(`{"timestamp":1}{`)
+	assert.Error(t, err4)
+}
+
+func TestBatchSummary(t *testing.T) {
+	mutatorConfig.Name = "sensu-grafana-mutator"
+	mutatorConfig.Keyspace = "sensu.io/plugins/sensu-grafana-mutator/config"
+	mutatorConfig.GrafanaURL = "https://grafana.com/?orgId=1"
+	mutatorConfig.GrafanaExploreLinkEnabled = true
+	mutatorConfig.GrafanaDashboardSuggested = `[{"grafana_annotation":"{{ .Labels.namespace }}","dashboard_url":"https://grafana.com/d/{{ .Labels.namespace }}?orgId=1","labels":["namespace"]},{"grafana_annotation":"broken","dashboard_url":"{{ .Missing }}","labels":["namespace"]}]`
+	defer func() {
+		mutatorConfig.GrafanaURL = ""
+		mutatorConfig.GrafanaExploreLinkEnabled = false
+		mutatorConfig.GrafanaDashboardSuggested = ""
+	}()
+	assert.NoError(t, checkArgs(nil))
+	summary := batchSummary{Links: make(map[string]int), Errors: make(map[string]int)}
+	for _, namespace := range []string{"default", "payments", "default"} {
+		event := v2.FixtureEvent("entity1", "check1")
+		event.Check.Labels = map[string]string{"namespace": namespace}
+		// annotations already in the event don't change the summary
+		event.Check.Annotations = map[string]string{"grafana_loki_url": "https://grafana.com/explore?orgId=1"}
+		mutated, err := summary.mutate(event)
+		assert.NoError(t, err)
+		assert.Contains(t, mutated.Check.Annotations, "grafana_"+namespace+"_url")
+	}
+	summary.Events = 4
+	summary.Mutated = 3
+	summary.fail("event 4 (entity1/check1): invalid")
+	// templated rules have one row for all label values
+	assert.Equal(t, map[string]int{"loki": 3, "grafana_{{ .labels.namespace }}_url": 3}, summary.Links)
+	assert.Equal(t, map[string]int{"grafana_broken_url": 3}, summary.Errors)
+	var buf bytes.Buffer
+	summary.write(&buf)
+	assert.Contains(t, buf.String(), "events: 4 mutated: 3 failed: 1")
+	assert.Contains(t, buf.String(), "grafana_broken_url")
+	assert.Contains(t, buf.String(), "failed event 4 (entity1/check1): invalid")
+}
+
+func TestBatchInput(t *testing.T) {
+	input1, args1 := batchInput([]string{"events.json", "--grafana-url", "https://grafana.com/?orgId=1"})
+	assert.Equal(t, "events.json", input1)
+	assert.Equal(t, []string{"--grafana-url", "https://grafana.com/?orgId=1"}, args1)
+
+	input2, args2 := batchInput([]string{"--grafana-url", "https://grafana.com/?orgId=1", "-g", "https://grafana.com/d/nodes", "--grafana-explore-link-enabled", "events.json"})
+	assert.Equal(t, "events.json", input2)
+	assert.Equal(t, []string{"--grafana-url", "https://grafana.com/?orgId=1", "-g", "https://grafana.com/d/nodes", "--grafana-explore-link-enabled"}, args2)
+
+	input3, args3 := batchInput([]string{"--grafana-url=https://grafana.com/?orgId=1", "-"})
+	assert.Equal(t, "-", input3)
+	assert.Equal(t, []string{"--grafana-url=https://grafana.com/?orgId=1"}, args3)
+
+	input4, args4 := batchInput([]string{"--grafana-url", "https://grafana.com/?orgId=1"})
+	assert.Equal(t, "", input4)
+	assert.Equal(t, 2, len(args4))
+}
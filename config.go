@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/betorvs/sensu-grafana-mutator/mutator"
+	"github.com/sensu-community/sensu-plugin-sdk/sensu"
+	"github.com/sensu/sensu-go/types"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// dashboardSuggestedKey is the config file key with the list of dashboards suggested
+	dashboardSuggestedKey = "grafana-dashboard-suggested"
+	// grafanaInstancesKey is the config file key with the list of grafana instances
+	grafanaInstancesKey = "grafana-instances"
+)
+
+// configFile struct is used to parse lists from --config-file instead of a json string
+type configFile struct {
+	GrafanaDashboardSuggested []mutator.DashboardSuggested `json:"grafana-dashboard-suggested" yaml:"grafana-dashboard-suggested"`
+	GrafanaInstances          []mutator.GrafanaInstance    `json:"grafana-instances" yaml:"grafana-instances"`
+	// Options keeps all other keys, then yaml.UnmarshalStrict only rejects unknown fields inside lists
+	Options map[string]interface{} `json:"-" yaml:",inline"`
+}
+
+// loadConfigFile reads a yaml or json file and set all options found there in c.
+// Options in explicit, set by command line flags, environment variables or annotations, have precedence
+// over config file, even if they are set to the default value.
+func loadConfigFile(c *Config, path string, explicit map[string]bool) error {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed reading config file %s: %v", path, err)
+	}
+	values := make(map[string]interface{})
+	lists := configFile{}
+	if strings.ToLower(filepath.Ext(path)) == ".json" {
+		raw := make(map[string]json.RawMessage)
+		err = json.Unmarshal(content, &raw)
+		if err == nil {
+			err = json.Unmarshal(content, &values)
+		}
+		if err == nil && raw[dashboardSuggestedKey] != nil {
+			lists.GrafanaDashboardSuggested, err = mutator.ParseDashboardSuggested(string(raw[dashboardSuggestedKey]))
+		}
+		if err == nil && raw[grafanaInstancesKey] != nil {
+			lists.GrafanaInstances, err = mutator.ParseGrafanaInstances(string(raw[grafanaInstancesKey]))
+		}
+	} else {
+		err = yaml.Unmarshal(content, &values)
+		if err == nil {
+			err = yaml.UnmarshalStrict(content, &lists)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed parsing config file %s: %v", path, err)
+	}
+	for key := range values {
+		if findOption(key) == nil {
+			return fmt.Errorf("unknown option %s in config file %s", key, path)
+		}
+	}
+	for _, opt := range configOptions(c) {
+		if opt.Argument == "" || opt.Argument == dashboardSuggestedKey || opt.Argument == grafanaInstancesKey || opt.Argument == "config-file" {
+			continue
+		}
+		value, ok := values[opt.Argument]
+		if !ok || explicit[opt.Argument] {
+			continue
+		}
+		if err := setConfigFileOption(opt.Value, value); err != nil {
+			return fmt.Errorf("invalid value for %s in config file %s: %v", opt.Argument, path, err)
+		}
+	}
+	if len(lists.GrafanaDashboardSuggested) != 0 && !explicit[dashboardSuggestedKey] {
+		dashboardJSON, err := json.Marshal(lists.GrafanaDashboardSuggested)
+		if err != nil {
+			return err
+		}
+		c.GrafanaDashboardSuggested = string(dashboardJSON)
+	}
+	if len(lists.GrafanaInstances) != 0 && !explicit[grafanaInstancesKey] {
+		instancesJSON, err := json.Marshal(lists.GrafanaInstances)
+		if err != nil {
+			return err
+		}
+		c.GrafanaInstances = string(instancesJSON)
+	}
+	return nil
+}
+
+// setConfigFileOption changes target to value found in config file
+func setConfigFileOption(target, value interface{}) error {
+	switch t := target.(type) {
+	case *string:
+		switch v := value.(type) {
+		case string:
+			*t = v
+		case []interface{}:
+			// accept lists for comma separated options. e. extra-loki-labels
+			items := []string{}
+			for _, item := range v {
+				items = append(items, fmt.Sprint(item))
+			}
+			*t = strings.Join(items, ",")
+		default:
+			*t = fmt.Sprint(v)
+		}
+	case *bool:
+		v, ok := value.(bool)
+		if !ok {
+			return fmt.Errorf("expected boolean, found %v", value)
+		}
+		*t = v
+	case *int:
+		switch v := value.(type) {
+		case int:
+			*t = v
+		case float64:
+			// encoding/json decodes all numbers as float64
+			*t = int(v)
+		default:
+			return fmt.Errorf("expected integer, found %v", value)
+		}
+	default:
+		return fmt.Errorf("unsupported option type %T", target)
+	}
+	return nil
+}
+
+// explicitOptions returns arguments of options set by command line flags in args, by environment
+// variables or by check or entity annotations in event (can be nil), even if they use the default value
+func explicitOptions(args []string, event *types.Event) map[string]bool {
+	flags := newOptionsFlagSet(configOptions(&Config{}))
+	// invalid flags are reported by sensu plugin sdk, flags parsed before an error are still used
+	_ = flags.Parse(args)
+	explicit := make(map[string]bool)
+	for _, opt := range options {
+		if flag := flags.Lookup(opt.Argument); flag != nil && flag.Changed {
+			explicit[opt.Argument] = true
+		}
+		if _, ok := os.LookupEnv(opt.Env); ok && opt.Env != "" {
+			explicit[opt.Argument] = true
+		}
+		if event != nil && opt.Path != "" && mutator.AnnotationOverride(event, mutatorConfig.Keyspace, opt.Path) != "" {
+			explicit[opt.Argument] = true
+		}
+	}
+	return explicit
+}
+
+// startupConfig returns options set by command line flags in args, environment variables and config file,
+// without check and entity annotations applied by sensu plugin sdk before checkArgs
+func startupConfig(args []string) Config {
+	c := Config{PluginConfig: mutatorConfig.PluginConfig}
+	flags := newOptionsFlagSet(configOptions(&c))
+	for _, opt := range options {
+		if value, ok := os.LookupEnv(opt.Env); ok && opt.Env != "" {
+			_ = flags.Set(opt.Argument, value)
+		}
+	}
+	// invalid flags and values are reported by sensu plugin sdk and buildMutator
+	_ = flags.Parse(args)
+	if c.ConfigFile != "" {
+		_ = loadConfigFile(&c, c.ConfigFile, explicitOptions(args, nil))
+	}
+	return c
+}
+
+// newOptionsFlagSet returns flags changing opts values, unknown flags are ignored
+func newOptionsFlagSet(opts []*sensu.PluginConfigOption) *pflag.FlagSet {
+	flags := pflag.NewFlagSet(mutatorConfig.Name, pflag.ContinueOnError)
+	flags.ParseErrorsWhitelist.UnknownFlags = true
+	flags.SetOutput(ioutil.Discard)
+	for _, opt := range opts {
+		switch v := opt.Value.(type) {
+		case *bool:
+			value, _ := opt.Default.(bool)
+			flags.BoolVarP(v, opt.Argument, opt.Shorthand, value, "")
+		case *int:
+			value, _ := opt.Default.(int)
+			flags.IntVarP(v, opt.Argument, opt.Shorthand, value, "")
+		case *string:
+			value, _ := opt.Default.(string)
+			flags.StringVarP(v, opt.Argument, opt.Shorthand, value, "")
+		}
+	}
+	return flags
+}
+
+func findOption(argument string) *sensu.PluginConfigOption {
+	for _, opt := range options {
+		if opt.Argument == argument {
+			return opt
+		}
+	}
+	return nil
+}
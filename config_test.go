@@ -0,0 +1,117 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	v2 "github.com/sensu/sensu-go/api/core/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	yamlFile := filepath.Join(dir, "config.yaml")
+	yamlContent := `
+grafana-url: https://grafana.example.com/?orgId=1
+grafana-explore-link-enabled: true
+grafana-mutator-time-range: 600
+extra-loki-labels:
+  - cluster
+  - pod
+grafana-dashboard-suggested:
+  - grafana_annotation: kubelet
+    dashboard_url: https://grafana.example.com/d/3138fa155d5915769fbded898ac09fd9/kubernetes-kubelet?orgId=1
+    labels:
+      - cluster
+    match_labels:
+      alertname: KubeletPlegDurationHigh
+`
+	err := ioutil.WriteFile(yamlFile, []byte(yamlContent), 0600)
+	assert.NoError(t, err)
+	mutatorConfig.GrafanaURL = ""
+	mutatorConfig.GrafanaExploreLinkEnabled = false
+	mutatorConfig.GrafanaMutatorTimeRange = 300
+	mutatorConfig.ExtraLokiLabels = "cluster,pod"
+	mutatorConfig.GrafanaDashboardSuggested = ""
+	err1 := loadConfigFile(&mutatorConfig, yamlFile, map[string]bool{})
+	assert.NoError(t, err1)
+	assert.Equal(t, "https://grafana.example.com/?orgId=1", mutatorConfig.GrafanaURL)
+	assert.True(t, mutatorConfig.GrafanaExploreLinkEnabled)
+	assert.Equal(t, 600, mutatorConfig.GrafanaMutatorTimeRange)
+	assert.Equal(t, "cluster,pod", mutatorConfig.ExtraLokiLabels)
+	assert.Contains(t, mutatorConfig.GrafanaDashboardSuggested, "\"match_labels\":{\"alertname\":\"KubeletPlegDurationHigh\"}")
+
+	// command line flags have precedence over config file, even using the default value
+	jsonFile := filepath.Join(dir, "config.json")
+	jsonContent := `{"grafana-url": "https://other.example.com/?orgId=2", "grafana-mutator-time-range": 900, "grafana-explore-link-enabled": false, "grafana-dashboard-suggested": [{"grafana_annotation":"nodes","dashboard_url":"https://grafana.example.com/d/nodes?orgId=1","labels":["node"]}]}`
+	err = ioutil.WriteFile(jsonFile, []byte(jsonContent), 0600)
+	assert.NoError(t, err)
+	mutatorConfig.GrafanaMutatorTimeRange = 300
+	explicit := map[string]bool{"grafana-url": true, "grafana-mutator-time-range": true}
+	err2 := loadConfigFile(&mutatorConfig, jsonFile, explicit)
+	assert.NoError(t, err2)
+	assert.Equal(t, "https://grafana.example.com/?orgId=1", mutatorConfig.GrafanaURL)
+	assert.Equal(t, 300, mutatorConfig.GrafanaMutatorTimeRange)
+	assert.False(t, mutatorConfig.GrafanaExploreLinkEnabled)
+	assert.Contains(t, mutatorConfig.GrafanaDashboardSuggested, "\"grafana_annotation\":\"nodes\"")
+
+	// dashboards list follows the same rule
+	mutatorConfig.GrafanaDashboardSuggested = `[{"grafana_annotation":"pods","dashboard_url":"https://grafana.example.com/d/pods?orgId=1","labels":["pod"]}]`
+	err6 := loadConfigFile(&mutatorConfig, jsonFile, map[string]bool{"grafana-dashboard-suggested": true})
+	assert.NoError(t, err6)
+	assert.Contains(t, mutatorConfig.GrafanaDashboardSuggested, "\"grafana_annotation\":\"pods\"")
+
+	unknownFile := filepath.Join(dir, "unknown.yaml")
+	err = ioutil.WriteFile(unknownFile, []byte("grafana-unknown: true\n"), 0600)
+	assert.NoError(t, err)
+	err3 := loadConfigFile(&mutatorConfig, unknownFile, map[string]bool{})
+	assert.Error(t, err3)
+
+	unknownFieldFile := filepath.Join(dir, "unknown-field.yaml")
+	err = ioutil.WriteFile(unknownFieldFile, []byte("grafana-dashboard-suggested:\n  - grafana_annotation: kubelet\n    dashboard_uri: https://grafana.example.com/d/uid?orgId=1\n"), 0600)
+	assert.NoError(t, err)
+	err5 := loadConfigFile(&mutatorConfig, unknownFieldFile, map[string]bool{})
+	assert.Error(t, err5)
+
+	err4 := loadConfigFile(&mutatorConfig, filepath.Join(dir, "missing.yaml"), map[string]bool{})
+	assert.Error(t, err4)
+
+	// reset global config used by other tests
+	mutatorConfig.GrafanaURL = ""
+	mutatorConfig.GrafanaExploreLinkEnabled = false
+	mutatorConfig.GrafanaMutatorTimeRange = 300
+	mutatorConfig.GrafanaDashboardSuggested = ""
+}
+
+func TestExplicitOptions(t *testing.T) {
+	assert.Empty(t, explicitOptions([]string{}, nil))
+	os.Setenv("GRAFANA_LOKI_DATASOURCE", "")
+	defer os.Unsetenv("GRAFANA_LOKI_DATASOURCE")
+	mutatorConfig.Keyspace = "sensu.io/plugins/sensu-grafana-mutator/config"
+	event := v2.FixtureEvent("entity1", "check1")
+	event.Entity.Annotations = map[string]string{"sensu.io/plugins/sensu-grafana-mutator/config/grafana-prometheus-metric": "up"}
+	args := []string{"--grafana-url", "https://grafana.com/?orgId=1", "-r", "300", "--unknown-flag", "--grafana-explore-link-enabled=false", "events.json"}
+	explicit := explicitOptions(args, event)
+	assert.Equal(t, map[string]bool{
+		"grafana-url":                  true,
+		"grafana-mutator-time-range":   true,
+		"grafana-explore-link-enabled": true,
+		"grafana-loki-datasource":      true,
+		"grafana-prometheus-metric":    true,
+	}, explicit)
+}
+
+func TestStartupConfig(t *testing.T) {
+	os.Setenv("GRAFANA_URL", "https://grafana.com/?orgId=1")
+	defer os.Unsetenv("GRAFANA_URL")
+	// values applied by sensu plugin sdk from event annotations are not used
+	mutatorConfig.GrafanaURL = "https://attacker.com/?orgId=1"
+	defer func() { mutatorConfig.GrafanaURL = "" }()
+	c := startupConfig([]string{"--grafana-instances", `[{"name":"eu","grafana_url":"https://grafana-eu.com/?orgId=2"}]`, "-r", "60"})
+	assert.Equal(t, "https://grafana.com/?orgId=1", c.GrafanaURL)
+	assert.Equal(t, 60, c.GrafanaMutatorTimeRange)
+	assert.Equal(t, "loki", c.GrafanaLokiDatasource)
+	assert.Equal(t, []string{"https://grafana.com/?orgId=1", "https://grafana-eu.com/?orgId=2"}, grafanaAPIURLs(c))
+}
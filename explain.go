@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/sensu-community/sensu-plugin-sdk/sensu"
+	"github.com/sensu/sensu-go/types"
+)
+
+// explainCommand runs sensu-grafana-mutator explain, it reads an event from stdin and prints
+// why each link was or wasn't created, using the same flags and environment variables
+func explainCommand() {
+	explain := sensu.NewGoCheck(&mutatorConfig.PluginConfig, options, checkExplainArgs, executeExplain, true)
+	explain.Execute()
+}
+
+func checkExplainArgs(event *types.Event) (int, error) {
+	if event == nil || event.Check == nil || event.Entity == nil {
+		return sensu.CheckStateUnknown, fmt.Errorf("explain requires an event with check and entity in stdin")
+	}
+	if err := checkArgs(event); err != nil {
+		return sensu.CheckStateUnknown, err
+	}
+	return sensu.CheckStateOK, nil
+}
+
+func executeExplain(event *types.Event) (int, error) {
+	linkMutator.Explain(os.Stdout, event)
+	return sensu.CheckStateOK, nil
+}
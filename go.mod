@@ -3,8 +3,11 @@ module github.com/betorvs/sensu-grafana-mutator
 go 1.16
 
 require (
+	github.com/robertkrimen/otto v0.0.0-20191219234010-c382bd3c16ff
 	github.com/sensu-community/sensu-plugin-sdk v0.11.0
 	github.com/sensu/sensu-go/api/core/v2 v2.4.0
 	github.com/sensu/sensu-go/types v0.3.0
+	github.com/spf13/pflag v1.0.3
 	github.com/stretchr/testify v1.6.0
+	gopkg.in/yaml.v2 v2.3.0
 )
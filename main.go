@@ -1,30 +1,43 @@
 package main
 
 import (
-	"encoding/json"
-	"fmt"
-	"net/url"
+	"os"
 	"strings"
 
+	"github.com/betorvs/sensu-grafana-mutator/mutator"
 	"github.com/sensu-community/sensu-plugin-sdk/sensu"
 	"github.com/sensu/sensu-go/types"
 )
 
-// DashboardSuggested struct
-type DashboardSuggested struct {
-	GrafanaAnnotation string            `json:"grafana_annotation"`
-	DashboardURL      string            `json:"dashboard_url"`
-	Labels            []string          `json:"labels"`
-	MatchLabels       map[string]string `json:"match_labels"`
-}
-
 // Config represents the mutator plugin config.
 type Config struct {
 	sensu.PluginConfig
+	ConfigFile                      string
 	GrafanaURL                      string
+	GrafanaInstances                string
 	GrafanaDashboardSuggested       string
+	GrafanaAPIToken                 string
+	GrafanaAPICacheFile             string
+	GrafanaAPICacheTTL              int
+	GrafanaDashboardsDir            string
+	GrafanaDashboardsTag            string
+	GrafanaRenderImages             bool
+	GrafanaRenderWidth              int
+	GrafanaRenderHeight             int
+	GrafanaRenderTheme              string
+	GrafanaRenderTimezone           string
 	GrafanaExploreLinkEnabled       bool
 	GrafanaLokiDatasource           string
+	GrafanaExploreURLVersion        string
+	GrafanaExploreSplitEnabled      bool
+	GrafanaExploreSplitPanes        string
+	GrafanaPrometheusLinkEnabled    bool
+	GrafanaPrometheusDatasource     string
+	GrafanaPrometheusMetric         string
+	GrafanaTempoLinkEnabled         bool
+	GrafanaTempoDatasource          string
+	TempoTraceIDLabel               string
+	TempoTraceIDRegex               string
 	SensuLabelSelector              string
 	KubernetesIntegrationLabel      string
 	KubernetesEventsIntegration     bool
@@ -38,12 +51,17 @@ type Config struct {
 	DefaultLokiLabelHostname        string
 	DefaultIntegrationsLabelNode    string
 	ExtraLokiLabels                 string
+	LokiStreamMatchers              string
 	AlwaysReturnEvent               bool
 	GrafanaMutatorTimeRange         int
-	TimeRange                       int64
+	ServeAddress                    string
+	ServeRequestTimeout             int
 }
 
 var (
+	// linkMutator is created by checkArgs using all options
+	linkMutator *mutator.Mutator
+
 	mutatorConfig = Config{
 		PluginConfig: sensu.PluginConfig{
 			Name:     "sensu-grafana-mutator",
@@ -52,7 +70,22 @@ var (
 		},
 	}
 
-	options = []*sensu.PluginConfigOption{
+	options = configOptions(&mutatorConfig)
+)
+
+// configOptions returns all options with values in c. Options are created for mutatorConfig at startup
+// and for a copy of it when annotations overrides are applied for one event (batch and serve).
+func configOptions(c *Config) []*sensu.PluginConfigOption {
+	return []*sensu.PluginConfigOption{
+		{
+			Path:      "",
+			Env:       "GRAFANA_MUTATOR_CONFIG_FILE",
+			Argument:  "config-file",
+			Shorthand: "c",
+			Default:   "",
+			Usage:     "Load all options from a yaml or json file (.json extension). Command line flags and environment variables have precedence over config file",
+			Value:     &c.ConfigFile,
+		},
 		{
 			Path:      "grafana-url",
 			Env:       "GRAFANA_URL",
@@ -60,7 +93,16 @@ var (
 			Shorthand: "g",
 			Default:   "",
 			Usage:     "An grafana complete URL. e. https://grafana.com/?orgId=1 ",
-			Value:     &mutatorConfig.GrafanaURL,
+			Value:     &c.GrafanaURL,
+		},
+		{
+			Path:      "grafana-instances",
+			Env:       "",
+			Argument:  "grafana-instances",
+			Shorthand: "",
+			Default:   "",
+			Usage:     "Route events to different Grafana instances using labels or entity namespace (only json format). First match is used, otherwise --grafana-url. e. [{\"name\":\"eu\",\"match_labels\":{\"cluster\":\"eu-1\"},\"grafana_url\":\"https://grafana-eu.example.com/?orgId=1\",\"loki_datasource\":\"loki-eu\"}]",
+			Value:     &c.GrafanaInstances,
 		},
 		{
 			Path:      "grafana-dashboard-suggested",
@@ -69,7 +111,98 @@ var (
 			Shorthand: "d",
 			Default:   "",
 			Usage:     "Suggested Dashboard based on Labels and add it in Grafana URL as &var-label[key]=label[value] (only json format). e. [{\"grafana_annotation\":\"kubernetes_namespace\",\"dashboard_url\":\"https://grafana.example.com/d/85a562078cdf77779eaa1add43ccec1e/kubernetes-compute-resources-namespace-pods?orgId=1&var-datasource=thanos\",\"labels\":[\"namespace\"]}]",
-			Value:     &mutatorConfig.GrafanaDashboardSuggested,
+			Value:     &c.GrafanaDashboardSuggested,
+		},
+		{
+			Path:      "",
+			Env:       "GRAFANA_API_TOKEN",
+			Argument:  "grafana-api-token",
+			Shorthand: "",
+			Default:   "",
+			Secret:    true,
+			Usage:     "Grafana API token (service account token) used to find dashboards by dashboard_uid, dashboard_title or dashboard_tag. Prefer GRAFANA_API_TOKEN environment variable",
+			Value:     &c.GrafanaAPIToken,
+		},
+		{
+			Path:      "",
+			Env:       "GRAFANA_API_CACHE_FILE",
+			Argument:  "grafana-api-cache-file",
+			Shorthand: "",
+			Default:   "",
+			Usage:     "File used to cache dashboards found using Grafana API between executions, written with 0600 permissions. Use a path only writable by sensu user. Empty keeps the cache only in memory",
+			Value:     &c.GrafanaAPICacheFile,
+		},
+		{
+			Path:      "",
+			Env:       "",
+			Argument:  "grafana-api-cache-ttl",
+			Shorthand: "",
+			Default:   3600,
+			Usage:     "Time in seconds to cache dashboards found using Grafana API",
+			Value:     &c.GrafanaAPICacheTTL,
+		},
+		{
+			Path:      "",
+			Env:       "GRAFANA_DASHBOARDS_DIR",
+			Argument:  "grafana-dashboards-dir",
+			Shorthand: "",
+			Default:   "",
+			Usage:     "Directory with provisioned Grafana dashboards JSON files. Dashboards tagged with --grafana-dashboards-tag are suggested when event has labels with all their template variables",
+			Value:     &c.GrafanaDashboardsDir,
+		},
+		{
+			Path:      "",
+			Env:       "",
+			Argument:  "grafana-dashboards-tag",
+			Shorthand: "",
+			Default:   mutator.DefaultDashboardsTag,
+			Usage:     "Dashboard tag used to choose dashboards in --grafana-dashboards-dir. Empty uses all dashboards",
+			Value:     &c.GrafanaDashboardsTag,
+		},
+		{
+			Path:      "grafana-render-images",
+			Env:       "",
+			Argument:  "grafana-render-images",
+			Shorthand: "",
+			Default:   false,
+			Usage:     "Add grafana_<name>_image_url with Grafana image renderer URL (/render/d-solo) for dashboards suggested with panel_id, panel_title or panels",
+			Value:     &c.GrafanaRenderImages,
+		},
+		{
+			Path:      "grafana-render-width",
+			Env:       "",
+			Argument:  "grafana-render-width",
+			Shorthand: "",
+			Default:   1000,
+			Usage:     "Panel image width in pixels",
+			Value:     &c.GrafanaRenderWidth,
+		},
+		{
+			Path:      "grafana-render-height",
+			Env:       "",
+			Argument:  "grafana-render-height",
+			Shorthand: "",
+			Default:   500,
+			Usage:     "Panel image height in pixels",
+			Value:     &c.GrafanaRenderHeight,
+		},
+		{
+			Path:      "grafana-render-theme",
+			Env:       "",
+			Argument:  "grafana-render-theme",
+			Shorthand: "",
+			Default:   "light",
+			Usage:     "Panel image theme: light or dark",
+			Value:     &c.GrafanaRenderTheme,
+		},
+		{
+			Path:      "grafana-render-timezone",
+			Env:       "",
+			Argument:  "grafana-render-timezone",
+			Shorthand: "",
+			Default:   "UTC",
+			Usage:     "Panel image timezone. e. UTC or Europe/Berlin. Empty uses Grafana default",
+			Value:     &c.GrafanaRenderTimezone,
 		},
 		{
 			Path:      "grafana-explore-link-enabled",
@@ -78,7 +211,7 @@ var (
 			Shorthand: "e",
 			Default:   false,
 			Usage:     "Enable Grafana Loki Explore Links",
-			Value:     &mutatorConfig.GrafanaExploreLinkEnabled,
+			Value:     &c.GrafanaExploreLinkEnabled,
 		},
 		{
 			Path:      "kubernetes-events-integration",
@@ -87,7 +220,7 @@ var (
 			Shorthand: "k",
 			Default:   false,
 			Usage:     "Grafana Mutator parser for sensu-kubernetes-events plugin",
-			Value:     &mutatorConfig.KubernetesEventsIntegration,
+			Value:     &c.KubernetesEventsIntegration,
 		},
 		{
 			Path:      "alertmanager-events-integration",
@@ -96,7 +229,7 @@ var (
 			Shorthand: "a",
 			Default:   false,
 			Usage:     "Grafana Mutator parser for sensu-alertmanager-events plugin",
-			Value:     &mutatorConfig.AlertmanagerEventsIntegration,
+			Value:     &c.AlertmanagerEventsIntegration,
 		},
 		{
 			Path:      "always-return-event",
@@ -104,8 +237,8 @@ var (
 			Argument:  "always-return-event",
 			Shorthand: "",
 			Default:   false,
-			Usage:     "Grafana Mutator will always return an event, even if it has error. All errors will be reported in event.annotations[sensu-grafana-mutator/error]",
-			Value:     &mutatorConfig.AlwaysReturnEvent,
+			Usage:     "Return events that cannot be mutated (e.g. without check) instead of failing. Link errors never fail the mutator, they are reported in event.check.annotations[sensu-grafana-mutator/error] and event.check.annotations[sensu-grafana-mutator/errors]",
+			Value:     &c.AlwaysReturnEvent,
 		},
 		{
 			Path:      "grafana-mutator-time-range",
@@ -114,7 +247,7 @@ var (
 			Shorthand: "r",
 			Default:   300,
 			Usage:     "Time range in seconds to create grafana URLs. It will use FromDate = 'event.timestamp - time-range' and ToDate = 'event.timestamp + time-range'",
-			Value:     &mutatorConfig.GrafanaMutatorTimeRange,
+			Value:     &c.GrafanaMutatorTimeRange,
 		},
 		{
 			Path:      "grafana-loki-datasource",
@@ -123,7 +256,97 @@ var (
 			Shorthand: "D",
 			Default:   "loki",
 			Usage:     "An Grafana Loki Datasource name. e. -d loki ",
-			Value:     &mutatorConfig.GrafanaLokiDatasource,
+			Value:     &c.GrafanaLokiDatasource,
+		},
+		{
+			Path:      "grafana-explore-url-version",
+			Env:       "GRAFANA_EXPLORE_URL_VERSION",
+			Argument:  "grafana-explore-url-version",
+			Shorthand: "",
+			Default:   mutator.ExploreURLLegacy,
+			Usage:     "Grafana Explore URL format: legacy (explore?left=[...]) or panes (explore?schemaVersion=1&panes={...}). Using panes, all datasource flags should be datasource UIDs",
+			Value:     &c.GrafanaExploreURLVersion,
+		},
+		{
+			Path:      "grafana-explore-split-enabled",
+			Env:       "",
+			Argument:  "grafana-explore-split-enabled",
+			Shorthand: "",
+			Default:   false,
+			Usage:     "Enable Grafana Explore split view Links using the two datasources from --grafana-explore-split-panes",
+			Value:     &c.GrafanaExploreSplitEnabled,
+		},
+		{
+			Path:      "grafana-explore-split-panes",
+			Env:       "GRAFANA_EXPLORE_SPLIT_PANES",
+			Argument:  "grafana-explore-split-panes",
+			Shorthand: "",
+			Default:   "loki,prometheus",
+			Usage:     "Grafana Explore split view panes (left,right). Options: loki, prometheus or tempo",
+			Value:     &c.GrafanaExploreSplitPanes,
+		},
+		{
+			Path:      "grafana-prometheus-link-enabled",
+			Env:       "",
+			Argument:  "grafana-prometheus-link-enabled",
+			Shorthand: "",
+			Default:   false,
+			Usage:     "Enable Grafana Prometheus Explore Links",
+			Value:     &c.GrafanaPrometheusLinkEnabled,
+		},
+		{
+			Path:      "grafana-prometheus-datasource",
+			Env:       "GRAFANA_PROMETHEUS_DATASOURCE",
+			Argument:  "grafana-prometheus-datasource",
+			Shorthand: "",
+			Default:   "prometheus",
+			Usage:     "An Grafana Prometheus (or Mimir/Thanos) Datasource name. e. --grafana-prometheus-datasource thanos ",
+			Value:     &c.GrafanaPrometheusDatasource,
+		},
+		{
+			Path:      "grafana-prometheus-metric",
+			Env:       "GRAFANA_PROMETHEUS_METRIC",
+			Argument:  "grafana-prometheus-metric",
+			Shorthand: "",
+			Default:   "up",
+			Usage:     "Metric used in Grafana Prometheus Explore URL. The same labels found for Loki are used as selector. e. up{namespace=value}",
+			Value:     &c.GrafanaPrometheusMetric,
+		},
+		{
+			Path:      "grafana-tempo-link-enabled",
+			Env:       "",
+			Argument:  "grafana-tempo-link-enabled",
+			Shorthand: "",
+			Default:   false,
+			Usage:     "Enable Grafana Tempo Explore Links using a trace ID found in event labels or in check output",
+			Value:     &c.GrafanaTempoLinkEnabled,
+		},
+		{
+			Path:      "grafana-tempo-datasource",
+			Env:       "GRAFANA_TEMPO_DATASOURCE",
+			Argument:  "grafana-tempo-datasource",
+			Shorthand: "",
+			Default:   "tempo",
+			Usage:     "An Grafana Tempo Datasource name. e. --grafana-tempo-datasource tempo ",
+			Value:     &c.GrafanaTempoDatasource,
+		},
+		{
+			Path:      "tempo-trace-id-label",
+			Env:       "TEMPO_TRACE_ID_LABEL",
+			Argument:  "tempo-trace-id-label",
+			Shorthand: "",
+			Default:   "trace_id",
+			Usage:     "Sensu label used as trace ID in Grafana Tempo Explore URL. It has precedence over --tempo-trace-id-regex",
+			Value:     &c.TempoTraceIDLabel,
+		},
+		{
+			Path:      "tempo-trace-id-regex",
+			Env:       "TEMPO_TRACE_ID_REGEX",
+			Argument:  "tempo-trace-id-regex",
+			Shorthand: "",
+			Default:   mutator.DefaultTraceIDRegex,
+			Usage:     "Regular expression used to find a trace ID in event.check.output. The first capture group is used as trace ID",
+			Value:     &c.TempoTraceIDRegex,
 		},
 		{
 			Path:      "sensu-label-selector",
@@ -132,7 +355,7 @@ var (
 			Shorthand: "s",
 			Default:   "kubernetes_namespace",
 			Usage:     "Sensu Label Selector to create Grafana Explore URL using loki as Datasource. {namespace=kubernetes_namespace.value}",
-			Value:     &mutatorConfig.SensuLabelSelector,
+			Value:     &c.SensuLabelSelector,
 		},
 		{
 			Path:      "alertmanager-integration-label",
@@ -141,7 +364,7 @@ var (
 			Shorthand: "A",
 			Default:   "sensu-alertmanager-events",
 			Usage:     "Label used to identify sensu-alertmanager-events plugin events",
-			Value:     &mutatorConfig.AlertmanagerIntegrationLabel,
+			Value:     &c.AlertmanagerIntegrationLabel,
 		},
 		{
 			Path:      "kubernetes-events-integration-label",
@@ -150,7 +373,7 @@ var (
 			Shorthand: "",
 			Default:   "sensu-kubernetes-events",
 			Usage:     "Label used to identify sensu-kubernetes-events plugin events",
-			Value:     &mutatorConfig.KubernetesIntegrationLabel,
+			Value:     &c.KubernetesIntegrationLabel,
 		},
 		{
 			Path:      "kubernetes-events-stream-label",
@@ -159,7 +382,7 @@ var (
 			Shorthand: "L",
 			Default:   "app",
 			Usage:     "Grafana Loki stream label. e. {app=eventrouter}",
-			Value:     &mutatorConfig.KubernetesEventsStreamLabel,
+			Value:     &c.KubernetesEventsStreamLabel,
 		},
 		{
 			Path:      "kubernetes-events-stream-selector",
@@ -168,7 +391,7 @@ var (
 			Shorthand: "S",
 			Default:   "eventrouter",
 			Usage:     "Grafana Loki stream selector. e. {app=eventrouter}",
-			Value:     &mutatorConfig.KubernetesEventsStreamSelector,
+			Value:     &c.KubernetesEventsStreamSelector,
 		},
 		{
 			Path:      "kubernetes-events-pipeline",
@@ -177,7 +400,7 @@ var (
 			Shorthand: "P",
 			Default:   "io.kubernetes.event.id",
 			Usage:     "Grafana Loki pipeline to match. e. {app=eventrouter} |= io.kubernetes.event.id",
-			Value:     &mutatorConfig.KubernetesEventsPipeline,
+			Value:     &c.KubernetesEventsPipeline,
 		},
 		{
 			Path:      "kubernetes-events-stream-namespace",
@@ -186,7 +409,7 @@ var (
 			Shorthand: "N",
 			Default:   "io.kubernetes.event.namespace",
 			Usage:     "Grafana Loki stream namespace. e. {app=eventrouter,namespace=io.kubernetes.event.namespace}",
-			Value:     &mutatorConfig.KubernetesEventsStreamNamespace,
+			Value:     &c.KubernetesEventsStreamNamespace,
 		},
 		{
 			Path:      "default-loki-label-namespace",
@@ -195,7 +418,7 @@ var (
 			Shorthand: "",
 			Default:   "namespace",
 			Usage:     "Default namespace label for Grafana Loki Stream. {namespace=value}",
-			Value:     &mutatorConfig.DefaultLokiLabelNamespace,
+			Value:     &c.DefaultLokiLabelNamespace,
 		},
 		{
 			Path:      "default-loki-label-hostname",
@@ -204,7 +427,7 @@ var (
 			Shorthand: "",
 			Default:   "hostname",
 			Usage:     "Default hostname label for Grafana Loki Stream. {hostname=value}",
-			Value:     &mutatorConfig.DefaultLokiLabelHostname,
+			Value:     &c.DefaultLokiLabelHostname,
 		},
 		{
 			Path:      "default-integrations-label-node",
@@ -213,7 +436,7 @@ var (
 			Shorthand: "",
 			Default:   "node",
 			Usage:     "Default node label from Kubernetes Events and Alert Manager integration.",
-			Value:     &mutatorConfig.DefaultIntegrationsLabelNode,
+			Value:     &c.DefaultIntegrationsLabelNode,
 		},
 		{
 			Path:      "extra-loki-labels",
@@ -222,397 +445,79 @@ var (
 			Shorthand: "",
 			Default:   "cluster,pod",
 			Usage:     "Extra labels for Grafana Loki Stream.",
-			Value:     &mutatorConfig.ExtraLokiLabels,
+			Value:     &c.ExtraLokiLabels,
+		},
+		{
+			Path:      "loki-stream-matchers",
+			Env:       "LOKI_STREAM_MATCHERS",
+			Argument:  "loki-stream-matchers",
+			Shorthand: "",
+			Default:   "",
+			Usage:     "Extra matchers for Grafana Loki Stream using =, !=, =~ or !~. e. container!=\"istio-proxy\",pod=~\"api-.*\"",
+			Value:     &c.LokiStreamMatchers,
+		},
+		{
+			Path:      "",
+			Env:       "GRAFANA_MUTATOR_SERVE_ADDRESS",
+			Argument:  "serve-address",
+			Shorthand: "",
+			Default:   ":8080",
+			Usage:     "Address used by serve command HTTP server",
+			Value:     &c.ServeAddress,
+		},
+		{
+			Path:      "",
+			Env:       "GRAFANA_MUTATOR_SERVE_REQUEST_TIMEOUT",
+			Argument:  "serve-request-timeout",
+			Shorthand: "",
+			Default:   10,
+			Usage:     "Request timeout in seconds used by serve command HTTP server",
+			Value:     &c.ServeRequestTimeout,
 		},
 	}
-)
+}
 
 func main() {
+	// subcommands use the same flags and environment variables
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "validate":
+			os.Args = append(os.Args[:1], os.Args[2:]...)
+			validateCommand()
+			return
+		case "explain":
+			os.Args = append(os.Args[:1], os.Args[2:]...)
+			explainCommand()
+			return
+		case "batch":
+			// optional input file before or after flags: sensu-grafana-mutator batch [flags] events.json
+			input, args := batchInput(os.Args[2:])
+			os.Args = append(os.Args[:1], args...)
+			batchCommand(input)
+			return
+		case "serve":
+			os.Args = append(os.Args[:1], os.Args[2:]...)
+			serveCommand()
+			return
+		}
+	}
 	mutator := sensu.NewGoMutator(&mutatorConfig.PluginConfig, options, checkArgs, executeMutator)
 	mutator.Execute()
 }
 
-func checkArgs(_ *types.Event) error {
-	if mutatorConfig.GrafanaDashboardSuggested == "" && !mutatorConfig.GrafanaExploreLinkEnabled {
-		return fmt.Errorf("please choose one of these two flags --grafana-dashboard-suggested or --grafana-explore-link-enabled")
-	}
-	if mutatorConfig.GrafanaExploreLinkEnabled && mutatorConfig.GrafanaURL == "" {
-		return fmt.Errorf("using --grafana-explore-link-enabled then --grafana-url or GRAFANA_URL environment variable is required")
+// checkArgs creates linkMutator, event is nil in batch and serve commands.
+// Sensu plugin sdk applies event annotations to options before it.
+func checkArgs(event *types.Event) error {
+	m, problems := buildMutator(&mutatorConfig, event, nil)
+	if len(problems) != 0 {
+		return mutator.JoinErrors(problems)
 	}
-	mutatorConfig.TimeRange = int64(mutatorConfig.GrafanaMutatorTimeRange * 1000)
+	linkMutator = m
 	return nil
 }
 
 func executeMutator(event *types.Event) (*types.Event, error) {
-	// log.Println("executing mutator with --grafana-url", mutatorConfig.GrafanaURL)
-	annotations := make(map[string]string)
-	fromDate := event.Timestamp*1000 - mutatorConfig.TimeRange
-	toDate := event.Timestamp*1000 + mutatorConfig.TimeRange
-	errorAnnotationName := fmt.Sprintf("%s/error", mutatorConfig.Name)
-	// if check.annotations is empty, make it
-	if event.Check.Annotations == nil {
-		event.Check.Annotations = make(map[string]string)
-	}
-	// to create grafana_loki_url annotation
-	if mutatorConfig.GrafanaExploreLinkEnabled {
-		labels := labelsToSearch()
-		extractedLabels, othersIntegrationsFound := extractLokiLabels(event, labels)
-		// using sensu-kubernetes-events plugin
-		if mutatorConfig.KubernetesEventsIntegration && othersIntegrationsFound == mutatorConfig.KubernetesIntegrationLabel {
-			grafanaURL, err := generateGrafanaURL(extractedLabels, fromDate, toDate)
-			if err != nil {
-				annotations[errorAnnotationName] = fmt.Sprintf("failed generating grafana URL %v", err)
-				event.Check.Annotations = mergeStringMaps(event.Check.Annotations, annotations)
-				if mutatorConfig.AlwaysReturnEvent {
-					return event, nil
-				}
-				return event, err
-			}
-			annotations["grafana_loki_url"] = grafanaURL
-		}
-		// using sensu-alertmanager-events plugin
-		if mutatorConfig.AlertmanagerEventsIntegration && othersIntegrationsFound == mutatorConfig.AlertmanagerIntegrationLabel {
-			grafanaURL, err := generateGrafanaURL(extractedLabels, fromDate, toDate)
-			if err != nil {
-				annotations[errorAnnotationName] = fmt.Sprintf("failed generating grafana URL %v", err)
-				event.Check.Annotations = mergeStringMaps(event.Check.Annotations, annotations)
-				if mutatorConfig.AlwaysReturnEvent {
-					return event, nil
-				}
-				return event, err
-			}
-			annotations["grafana_loki_url"] = grafanaURL
-		}
-		// using sensu label defined in --sensu-label-selector
-		if othersIntegrationsFound == "none" {
-			grafanaURL, err := generateGrafanaURL(extractedLabels, fromDate, toDate)
-			if err != nil {
-				annotations[errorAnnotationName] = fmt.Sprintf("failed generating grafana URL %v", err)
-				event.Check.Annotations = mergeStringMaps(event.Check.Annotations, annotations)
-				if mutatorConfig.AlwaysReturnEvent {
-					return event, nil
-				}
-				return event, err
-			}
-			annotations["grafana_loki_url"] = grafanaURL
-		}
-
-	}
-	// add any dashboard configured in --grafana-dashboard-suggested
-	if mutatorConfig.GrafanaDashboardSuggested != "" {
-		dashboardSuggested := []DashboardSuggested{}
-		err := json.Unmarshal([]byte(mutatorConfig.GrafanaDashboardSuggested), &dashboardSuggested)
-		if err != nil {
-			annotations[errorAnnotationName] = fmt.Sprintf("json config %v", err)
-			event.Check.Annotations = mergeStringMaps(event.Check.Annotations, annotations)
-			if mutatorConfig.AlwaysReturnEvent {
-				return event, nil
-			}
-			return event, err
-		}
-		for _, v := range dashboardSuggested {
-			output := fmt.Sprintf("grafana_%s_url", strings.ToLower(v.GrafanaAnnotation))
-			grafanaURL, err := url.Parse(v.DashboardURL)
-			if err != nil {
-				annotations[errorAnnotationName] = fmt.Sprintf("failed generating grafana URL %v", err)
-				event.Check.Annotations = mergeStringMaps(event.Check.Annotations, annotations)
-				if mutatorConfig.AlwaysReturnEvent {
-					return event, nil
-				}
-				return event, err
-			}
-			if !checkMissingOrgID(grafanaURL.Query()) {
-				annotations[errorAnnotationName] = "Missing orgId in grafana URL in --grafana-dashboard-suggested. e. https://grafana.com/?orgId=1"
-				event.Check.Annotations = mergeStringMaps(event.Check.Annotations, annotations)
-				if mutatorConfig.AlwaysReturnEvent {
-					return event, nil
-				}
-				return event, fmt.Errorf("Missing orgId in grafana URL in --grafana-dashboard-suggested. e. https://grafana.com/?orgId=1")
-			}
-			timeRange := fmt.Sprintf("&from=%d&to=%d", fromDate, toDate)
-			if v.MatchLabels != nil {
-				if searchMatchLabels(event, v.MatchLabels) {
-					if v.Labels != nil {
-						// case match matchLabels and found labels
-						finalURI, validFinalURI := generateURIBySlice(event, v.Labels)
-						if validFinalURI {
-							annotations[output] = fmt.Sprintf("%s%s%s", grafanaURL, timeRange, finalURI)
-						}
-					} else {
-						// only match labels is used, no labels provided
-						annotations[output] = fmt.Sprintf("%s%s", grafanaURL, timeRange)
-					}
-				}
-
-			} else {
-				finalURI, validFinalURI := generateURIBySlice(event, v.Labels)
-				if validFinalURI {
-					annotations[output] = fmt.Sprintf("%s%s%s", grafanaURL, timeRange, finalURI)
-				}
-			}
-		}
-
-	}
-
-	// merge new annotations into event.check.annotation
-	event.Check.Annotations = mergeStringMaps(event.Check.Annotations, annotations)
-
-	return event, nil
-}
-
-func generateGrafanaURL(l map[string]string, fromDate, toDate int64) (string, error) {
-	grafanaURL, err := grafanaExploreURLEncoded(l, mutatorConfig.GrafanaURL, mutatorConfig.GrafanaLokiDatasource, fromDate, toDate)
-	if err != nil {
-		return "", err
-	}
-	return grafanaURL, nil
-}
-
-func replaceSpecial(s string) string {
-	//  [
-	value := strings.ReplaceAll(s, "[", "%5B")
-	//  ] %5D
-	value = strings.ReplaceAll(value, "]", "%5D")
-	//  " %22
-	value = strings.ReplaceAll(value, "\"", "%22")
-	// { %7B
-	value = strings.ReplaceAll(value, "{", "%7B")
-	// } %7D
-	value = strings.ReplaceAll(value, "}", "%7D")
-	return value
-}
-
-func grafanaExploreURLEncoded(labels map[string]string, grafana, datasource string, fromDate, toDate int64) (string, error) {
-	// grafana URL expected: https://grafana.com/?orgId=1
-	grafanaURL, err := url.Parse(grafana)
-	if err != nil {
-		return "", err
-	}
-	// if grafana URL not contain "?orgId=1" return a error in the end of this func
-	var errOrgID error
-	if !checkMissingOrgID(grafanaURL.Query()) {
-		errOrgID = fmt.Errorf("Missing orgId in grafana URL. e. https://grafana.com/?orgId=1")
-	}
-	grafanaURL.Path = "explore"
-	grafanaExploreURL := fmt.Sprintf("%s&left=", grafanaURL)
-	var labelsSearchText, startSearchText, endSearchText string
-	var eventID bool
-	count := 0
-	for key, value := range labels {
-		if key != "" && value != "" && key != "eventID" {
-			if count == 0 {
-				labelsSearchText += fmt.Sprintf("%s=\\\"%s\\\"", key, value)
-				count++
-			} else {
-				labelsSearchText += fmt.Sprintf(",%s=\\\"%s\\\"", key, value)
-				count++
-			}
-		}
-		if key == "eventID" && value != "" {
-			endSearchText = fmt.Sprintf("|=\\\"%s\\\"", value)
-			eventID = true
-			count++
-		}
-	}
-	startSearchText = fmt.Sprintf("{%s}", labelsSearchText)
-	searchText := url.QueryEscape(startSearchText)
-	if eventID {
-		searchText = url.QueryEscape(fmt.Sprintf("%s%s", startSearchText, endSearchText))
-	}
-	grafanaExploreURI := fmt.Sprintf("[\"%d\",\"%d\",\"%s\",{\"expr\":\"%s\"}]", fromDate, toDate, datasource, searchText)
-	result := fmt.Sprintf("%s%s", grafanaExploreURL, replaceSpecial(grafanaExploreURI))
-	return result, errOrgID
-}
-
-func checkMissingOrgID(u url.Values) bool {
-	for k, v := range u {
-		if k == "orgId" && len(v) != 0 {
-			return true
-		}
-	}
-	return false
-}
-
-func extractLabels(event *types.Event, label string) (string, bool) {
-	labelFound := ""
-	if event.Labels != nil {
-		for k, v := range event.Labels {
-			if k == label {
-				labelFound = v
-			}
-		}
-	}
-	if event.Entity.Labels != nil {
-		for k, v := range event.Entity.Labels {
-			if k == label {
-				labelFound = v
-			}
-		}
-	}
-	if event.Check.Labels != nil {
-		for k, v := range event.Check.Labels {
-			if k == label {
-				labelFound = v
-			}
-		}
-	}
-	if labelFound == "" {
-		return labelFound, false
-	}
-	return labelFound, true
-}
-
-func labelsToSearch() []string {
-	labels := stringToSliceStrings(mutatorConfig.ExtraLokiLabels)
-	if mutatorConfig.KubernetesEventsIntegration {
-		labels = append(labels, mutatorConfig.KubernetesEventsStreamNamespace)
-		labels = append(labels, mutatorConfig.KubernetesEventsPipeline)
-	}
-	labels = append(labels, mutatorConfig.DefaultLokiLabelNamespace)
-	if mutatorConfig.SensuLabelSelector != mutatorConfig.DefaultLokiLabelNamespace {
-		labels = append(labels, mutatorConfig.SensuLabelSelector)
-	}
-	if mutatorConfig.AlertmanagerEventsIntegration {
-		labels = append(labels, mutatorConfig.DefaultIntegrationsLabelNode)
-	}
-	return labels
-}
-
-func renameKey(s string) string {
-	switch {
-	case s == mutatorConfig.KubernetesEventsStreamNamespace:
-		return mutatorConfig.DefaultLokiLabelNamespace
-	case s == mutatorConfig.KubernetesEventsPipeline:
-		return "eventID"
-	case s == mutatorConfig.SensuLabelSelector:
-		return mutatorConfig.DefaultLokiLabelNamespace
-	case s == mutatorConfig.DefaultIntegrationsLabelNode:
-		return mutatorConfig.DefaultLokiLabelHostname
-	default:
-		return s
-	}
-}
-
-func extractLokiLabels(event *types.Event, labels []string) (map[string]string, string) {
-	labelsFound := make(map[string]string)
-	othersIntegrationsFound := "none"
-	var hostnameFound bool
-	for _, l := range labels {
-		// [mutatorConfig.KubernetesIntegrationLabel] == "owner"
-		if event.Labels != nil {
-			for k, v := range event.Labels {
-				if k == l {
-					key := renameKey(k)
-					labelsFound[key] = v
-				}
-			}
-		}
-		if event.Entity.Labels != nil {
-			for k, v := range event.Entity.Labels {
-				if k == l {
-					key := renameKey(k)
-					labelsFound[key] = v
-				}
-			}
-		}
-		// [mutatorConfig.AlertmanagerIntegrationLabel] == "owner"
-		if event.Check.Labels != nil {
-			for k, v := range event.Check.Labels {
-				if k == l {
-					key := renameKey(k)
-					value := v
-					if k == mutatorConfig.DefaultIntegrationsLabelNode {
-						// if doesnt find namespace in labels, use hostname = node
-						// in Loki every node is labeled as hostname
-						// in alert manager/kubernetes the label is node and it used a FQDN
-						// example: ip-10-192-172-1.eu-west-1.compute.internal
-						if strings.Contains(value, ".") {
-							newapp := strings.Split(value, ".")
-							value = newapp[0]
-							hostnameFound = true
-						}
-					}
-					labelsFound[key] = value
-				}
-				if k == mutatorConfig.AlertmanagerIntegrationLabel && v == "owner" {
-					othersIntegrationsFound = mutatorConfig.AlertmanagerIntegrationLabel
-				}
-			}
-		}
-	}
-	if hostnameFound && event.Check.Labels[mutatorConfig.AlertmanagerIntegrationLabel] == "owner" {
-		onlyHostnameLabel := make(map[string]string)
-		onlyHostnameLabel[mutatorConfig.DefaultLokiLabelHostname] = labelsFound[mutatorConfig.DefaultLokiLabelHostname]
-		return onlyHostnameLabel, mutatorConfig.AlertmanagerIntegrationLabel
-	}
-	if event.Labels[mutatorConfig.KubernetesIntegrationLabel] == "owner" {
-		k8sEventsLabel := map[string]string{mutatorConfig.KubernetesEventsStreamLabel: mutatorConfig.KubernetesEventsStreamSelector}
-		k8sEventsLabel["eventID"] = labelsFound["eventID"]
-		return k8sEventsLabel, mutatorConfig.KubernetesIntegrationLabel
-	}
-	return labelsFound, othersIntegrationsFound
-}
-
-func generateURIBySlice(event *types.Event, v []string) (string, bool) {
-	count := 0
-	finalURI := ""
-	for _, s := range v {
-		// &var-namespace=test
-		value, validFinalURI := extractLabels(event, s)
-		if validFinalURI {
-			finalURI += fmt.Sprintf("&var-%s=%s", s, value)
-			count++
-		}
-	}
-	if len(v) == count {
-		return finalURI, true
-	}
-	return "", false
-}
-
-func searchMatchLabels(event *types.Event, labels map[string]string) bool {
-	if len(labels) == 0 {
-		return false
-	}
-	count := 0
-	for key, value := range labels {
-		if event.Labels != nil {
-			for k, v := range event.Labels {
-				if k == key && v == value {
-					count++
-				}
-			}
-		}
-		if event.Entity.Labels != nil {
-			for k, v := range event.Entity.Labels {
-				if k == key && v == value {
-					count++
-				}
-			}
-		}
-		if event.Check.Labels != nil {
-			for k, v := range event.Check.Labels {
-				if k == key && v == value {
-					count++
-				}
-			}
-		}
-		if count == len(labels) {
-			return true
-		}
-	}
-
-	return false
-}
-
-func mergeStringMaps(left, right map[string]string) map[string]string {
-	for k, v := range right {
-		// fmt.Println(left[k])
-		if left[k] == "" {
-			left[k] = v
-		}
-	}
-	return left
+	return linkMutator.Mutate(event)
 }
 
 func stringToSliceStrings(s string) []string {
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// metricsPrefix is used in all metric names
+const metricsPrefix = "sensu_grafana_mutator"
+
+// mutatorMetrics is exposed by serve command in GET /metrics using prometheus text format
+var mutatorMetrics = newMetrics()
+
+// durationBuckets are the mutation latency histogram buckets in seconds
+var durationBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1}
+
+// metrics struct keeps counters by label values and the mutation latency histogram
+type metrics struct {
+	mu             sync.Mutex
+	events         map[string]float64
+	links          map[string]float64
+	ruleMatches    map[[2]string]float64
+	errors         map[[2]string]float64
+	durationCounts []float64
+	durationSum    float64
+	durationCount  float64
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		events:         make(map[string]float64),
+		links:          make(map[string]float64),
+		ruleMatches:    make(map[[2]string]float64),
+		errors:         make(map[[2]string]float64),
+		durationCounts: make([]float64, len(durationBuckets)),
+	}
+}
+
+// observeEvent counts one event by result: mutated, failed or invalid
+func (m *metrics) observeEvent(result string, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.events[result]++
+	seconds := duration.Seconds()
+	for i, bucket := range durationBuckets {
+		if seconds <= bucket {
+			m.durationCounts[i]++
+		}
+	}
+	m.durationSum += seconds
+	m.durationCount++
+}
+
+// observeLink counts one link created or failed by rule name. Rendered annotation names are not used as label
+// values because dashboard rules using templates create one name for each label value
+func (m *metrics) observeLink(rule string, created bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if created {
+		m.links[rule]++
+		return
+	}
+	m.errors[[2]string{"link", rule}]++
+}
+
+// observeRule counts if a dashboard rule matched the event
+func (m *metrics) observeRule(rule string, matched bool) {
+	result := "miss"
+	if matched {
+		result = "match"
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.ruleMatches[[2]string{rule, result}]++
+}
+
+// observeError counts errors not related to one link. e. mutation
+func (m *metrics) observeError(errorType string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.errors[[2]string{errorType, ""}]++
+}
+
+// write uses prometheus text exposition format version 0.0.4
+func (m *metrics) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	prefix := metricsPrefix
+
+	fmt.Fprintf(w, "# HELP %s_events_total Events processed by result.\n", prefix)
+	fmt.Fprintf(w, "# TYPE %s_events_total counter\n", prefix)
+	for _, k := range sortedKeys(m.events) {
+		fmt.Fprintf(w, "%s_events_total{result=%s} %v\n", prefix, labelValue(k), m.events[k])
+	}
+
+	fmt.Fprintf(w, "# HELP %s_links_total Links created by rule.\n", prefix)
+	fmt.Fprintf(w, "# TYPE %s_links_total counter\n", prefix)
+	for _, k := range sortedKeys(m.links) {
+		fmt.Fprintf(w, "%s_links_total{rule=%s} %v\n", prefix, labelValue(k), m.links[k])
+	}
+
+	fmt.Fprintf(w, "# HELP %s_rule_matches_total Dashboard rules matched or missed.\n", prefix)
+	fmt.Fprintf(w, "# TYPE %s_rule_matches_total counter\n", prefix)
+	for _, k := range sortedPairs(m.ruleMatches) {
+		fmt.Fprintf(w, "%s_rule_matches_total{rule=%s,result=%s} %v\n", prefix, labelValue(k[0]), labelValue(k[1]), m.ruleMatches[k])
+	}
+
+	fmt.Fprintf(w, "# HELP %s_errors_total Errors by type and rule.\n", prefix)
+	fmt.Fprintf(w, "# TYPE %s_errors_total counter\n", prefix)
+	for _, k := range sortedPairs(m.errors) {
+		fmt.Fprintf(w, "%s_errors_total{type=%s,rule=%s} %v\n", prefix, labelValue(k[0]), labelValue(k[1]), m.errors[k])
+	}
+
+	fmt.Fprintf(w, "# HELP %s_mutation_duration_seconds Event mutation latency.\n", prefix)
+	fmt.Fprintf(w, "# TYPE %s_mutation_duration_seconds histogram\n", prefix)
+	for i, bucket := range durationBuckets {
+		fmt.Fprintf(w, "%s_mutation_duration_seconds_bucket{le=\"%v\"} %v\n", prefix, bucket, m.durationCounts[i])
+	}
+	fmt.Fprintf(w, "%s_mutation_duration_seconds_bucket{le=\"+Inf\"} %v\n", prefix, m.durationCount)
+	fmt.Fprintf(w, "%s_mutation_duration_seconds_sum %v\n", prefix, m.durationSum)
+	fmt.Fprintf(w, "%s_mutation_duration_seconds_count %v\n", prefix, m.durationCount)
+}
+
+// labelValue escapes backslash, double quote and line feed
+func labelValue(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedPairs(m map[[2]string]float64) [][2]string {
+	keys := [][2]string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+	return keys
+}
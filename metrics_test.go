@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsWrite(t *testing.T) {
+	m := newMetrics()
+	m.observeEvent("mutated", 3*time.Millisecond)
+	m.observeEvent("failed", 2*time.Second)
+	m.observeLink("loki", true)
+	m.observeLink("grafana_nodes_url", false)
+	m.observeRule("grafana_nodes_url", false)
+	m.observeRule("grafana_nodes_url", false)
+	m.observeRule("grafana_kubelet_url", true)
+	m.observeError("mutation")
+	var buf bytes.Buffer
+	m.write(&buf)
+	result := buf.String()
+	assert.Contains(t, result, "# TYPE sensu_grafana_mutator_events_total counter\n")
+	assert.Contains(t, result, `sensu_grafana_mutator_events_total{result="mutated"} 1`)
+	assert.Contains(t, result, `sensu_grafana_mutator_links_total{rule="loki"} 1`)
+	assert.Contains(t, result, `sensu_grafana_mutator_rule_matches_total{rule="grafana_nodes_url",result="miss"} 2`)
+	assert.Contains(t, result, `sensu_grafana_mutator_rule_matches_total{rule="grafana_kubelet_url",result="match"} 1`)
+	assert.Contains(t, result, `sensu_grafana_mutator_errors_total{type="link",rule="grafana_nodes_url"} 1`)
+	assert.Contains(t, result, `sensu_grafana_mutator_errors_total{type="mutation",rule=""} 1`)
+	assert.Contains(t, result, `sensu_grafana_mutator_mutation_duration_seconds_bucket{le="0.0025"} 0`)
+	assert.Contains(t, result, `sensu_grafana_mutator_mutation_duration_seconds_bucket{le="0.005"} 1`)
+	assert.Contains(t, result, `sensu_grafana_mutator_mutation_duration_seconds_bucket{le="+Inf"} 2`)
+	assert.Contains(t, result, "sensu_grafana_mutator_mutation_duration_seconds_count 2\n")
+}
+
+func TestLabelValue(t *testing.T) {
+	assert.Equal(t, `"a\"b\\c\nd"`, labelValue("a\"b\\c\nd"))
+}
@@ -0,0 +1,192 @@
+package mutator
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/sensu/sensu-go/types"
+)
+
+// Explain writes a trace for each link: labels searched and where they were found,
+// integration detected, dashboards matched and the final URL or why it was skipped.
+// Each link provider writes its own trace.
+func (m *Mutator) Explain(w io.Writer, event *types.Event) {
+	window := m.window(event)
+	instance := m.selectGrafanaInstance(event)
+	instanceName := instance.Name
+	if instanceName == "" {
+		instanceName = "default"
+	}
+	fmt.Fprintf(w, "grafana instance: %s (%s)\n", instanceName, instance.GrafanaURL)
+	fmt.Fprintf(w, "time range: from=%d to=%d\n", window.From, window.To)
+
+	if m.config.GrafanaExploreLinkEnabled || m.config.GrafanaPrometheusLinkEnabled || m.config.GrafanaExploreSplitEnabled {
+		labels := m.labelsToSearch()
+		extractedLabels, othersIntegrationsFound := m.extractLokiLabels(event, labels)
+		fmt.Fprintf(w, "\nexplore labels:\n")
+		for _, l := range labels {
+			fmt.Fprintf(w, "  %s: %s\n", l, labelSources(event, l))
+		}
+		fmt.Fprintf(w, "  integration: %s\n", m.explainIntegration(othersIntegrationsFound))
+		fmt.Fprintf(w, "  loki stream selector: %s\n", streamSelector(extractedLabels, nil))
+	}
+
+	for _, provider := range m.providers {
+		if explainer, ok := provider.(Explainer); ok {
+			explainer.Explain(w, event, window)
+		} else {
+			ExplainLinks(w, provider, event, window)
+		}
+	}
+}
+
+// ExplainLinks writes the links created by provider, or why it was skipped, in a section with the provider name.
+// It can be used by link providers without their own trace.
+func ExplainLinks(w io.Writer, provider LinkProvider, event *types.Event, window Window) {
+	fmt.Fprintf(w, "\nprovider %s:\n", provider.Name())
+	if !provider.Applies(event) {
+		fmt.Fprintf(w, "  skipped: provider doesn't apply to this event\n")
+		return
+	}
+	links, err := provider.Build(event, window)
+	for _, link := range links {
+		fmt.Fprintf(w, "  %s: %s\n", link.Name, link.URL)
+	}
+	explainError(w, err)
+}
+
+// explainBuild writes the URL and errors returned by a built-in provider creating one link
+func explainBuild(w io.Writer, provider LinkProvider, event *types.Event, window Window) {
+	links, err := provider.Build(event, window)
+	for _, link := range links {
+		fmt.Fprintf(w, "  url: %s\n", link.URL)
+	}
+	explainError(w, err)
+}
+
+// explainError writes each reason in LinkErrors or the error message
+func explainError(w io.Writer, err error) {
+	if err == nil {
+		return
+	}
+	if linkErrors, ok := err.(LinkErrors); ok {
+		for _, e := range linkErrors {
+			fmt.Fprintf(w, "  error: %s\n", e.Reason)
+		}
+		return
+	}
+	fmt.Fprintf(w, "  error: %v\n", err)
+}
+
+// explainDashboard writes each condition checked for one dashboard and its links
+func explainDashboard(w io.Writer, event *types.Event, result dashboardResult) {
+	v := result.v
+	fmt.Fprintf(w, "\n%s (dashboard %s):\n", result.output, v.GrafanaAnnotation)
+	if !result.resolved {
+		// dashboard couldn't be resolved, there is nothing else to check
+		explainError(w, result.err)
+		return
+	}
+	switch {
+	case v.DashboardUID != "" || v.DashboardTitle != "" || v.DashboardTag != "":
+		fmt.Fprintf(w, "  dashboard_url from grafana API: %s\n", v.DashboardURL)
+	case v.DashboardFile != "":
+		fmt.Fprintf(w, "  dashboard_url from dashboard_file: %s\n", v.DashboardURL)
+	}
+	for _, variable := range result.autoVariables {
+		if autoVariableFilled(v, variable) {
+			fmt.Fprintf(w, "  auto variable %s: filled by labels\n", variable)
+			continue
+		}
+		fmt.Fprintf(w, "  auto variable %s: %s\n", variable, labelSources(event, variable))
+	}
+	if v.MatchLabels != nil {
+		keys := []string{}
+		for k := range v.MatchLabels {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(w, "  match_labels %s=%s: %s\n", k, v.MatchLabels[k], labelSources(event, k))
+		}
+		fmt.Fprintf(w, "  match_labels matched: %t\n", searchMatchLabels(event, v.MatchLabels))
+	}
+	for _, selector := range v.MatchSelectors {
+		matched, err := searchMatchSelectors(event, []string{selector})
+		if err != nil {
+			fmt.Fprintf(w, "  match_selectors %s: %v\n", selector, err)
+			continue
+		}
+		fmt.Fprintf(w, "  match_selectors %s matched: %t\n", selector, matched)
+	}
+	if v.Expression != "" {
+		matched, err := evaluateExpression(event, v.Expression)
+		if err != nil {
+			fmt.Fprintf(w, "  expression: %v\n", err)
+		} else {
+			fmt.Fprintf(w, "  expression %s matched: %t\n", v.Expression, matched)
+		}
+	}
+	for _, l := range v.Labels {
+		fmt.Fprintf(w, "  label %s: %s\n", l, labelSources(event, l))
+	}
+	if panelID := selectPanel(event, v); panelID != 0 {
+		fmt.Fprintf(w, "  view panel: %d\n", panelID)
+	}
+	switch {
+	case result.err != nil:
+		explainError(w, result.err)
+	case result.url == "" && (v.MatchLabels != nil || len(v.MatchSelectors) != 0 || v.Expression != "") && !explainMatched(event, v):
+		fmt.Fprintf(w, "  skipped: match_labels, match_selectors or expression didn't match\n")
+	case result.url == "":
+		fmt.Fprintf(w, "  skipped: not all labels were found\n")
+	default:
+		fmt.Fprintf(w, "  url: %s\n", result.url)
+		for _, link := range result.links[1:] {
+			fmt.Fprintf(w, "  image url: %s\n", link.URL)
+		}
+		for _, e := range result.linkErrors {
+			fmt.Fprintf(w, "  image error: %s\n", e.Reason)
+		}
+	}
+}
+
+func explainMatched(event *types.Event, v DashboardSuggested) bool {
+	matched, err := matchDashboardSuggested(event, v)
+	return err == nil && matched
+}
+
+func (m *Mutator) explainIntegration(othersIntegrationsFound string) string {
+	switch othersIntegrationsFound {
+	case m.config.KubernetesIntegrationLabel:
+		return fmt.Sprintf("%s (label %s=owner in event labels)", othersIntegrationsFound, m.config.KubernetesIntegrationLabel)
+	case m.config.AlertmanagerIntegrationLabel:
+		return fmt.Sprintf("%s (label %s=owner in check labels)", othersIntegrationsFound, m.config.AlertmanagerIntegrationLabel)
+	}
+	return "none (sensu labels)"
+}
+
+// labelSources returns where a label was found: event, entity and check labels.
+// Check labels have precedence over entity labels and entity labels over event labels.
+func labelSources(event *types.Event, key string) string {
+	sources := []string{}
+	if value, ok := event.Labels[key]; ok {
+		sources = append(sources, fmt.Sprintf("event.metadata.labels=%q", value))
+	}
+	if event.Entity != nil {
+		if value, ok := event.Entity.Labels[key]; ok {
+			sources = append(sources, fmt.Sprintf("entity.metadata.labels=%q", value))
+		}
+	}
+	if event.Check != nil {
+		if value, ok := event.Check.Labels[key]; ok {
+			sources = append(sources, fmt.Sprintf("check.metadata.labels=%q", value))
+		}
+	}
+	if len(sources) == 0 {
+		return "not found"
+	}
+	return "found in " + strings.Join(sources, ", ")
+}
@@ -0,0 +1,36 @@
+package mutator
+
+import (
+	"bytes"
+	"testing"
+
+	v2 "github.com/sensu/sensu-go/api/core/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExplainEvent(t *testing.T) {
+	config := DefaultConfig()
+	config.GrafanaURL = "https://grafana.com/?orgId=1"
+	config.GrafanaExploreLinkEnabled = true
+	config.GrafanaDashboardSuggested, _ = ParseDashboardSuggested(`[{"grafana_annotation":"nodes","dashboard_url":"https://grafana.com/d/nodes?orgId=1","labels":["namespace","pod"]},{"grafana_annotation":"alerts","dashboard_url":"https://grafana.com/d/alerts?orgId=1","match_labels":{"alertname":"Watchdog"}}]`)
+	m, err := New(config)
+	assert.NoError(t, err)
+	event := v2.FixtureEvent("entity1", "check1")
+	event.Check.Labels = map[string]string{"namespace": "spacename"}
+	var buf bytes.Buffer
+	m.Explain(&buf, event)
+	result := buf.String()
+	assert.Contains(t, result, `namespace: found in check.metadata.labels="spacename"`)
+	assert.Contains(t, result, "integration: none")
+	assert.Contains(t, result, "grafana_loki_url (provider loki):\n  url: https://grafana.com/explore?orgId=1")
+	assert.Contains(t, result, "label pod: not found\n  skipped: not all labels were found")
+	assert.Contains(t, result, "match_labels matched: false\n  skipped: match_labels, match_selectors or expression didn't match")
+}
+
+func TestLabelSources(t *testing.T) {
+	event := v2.FixtureEvent("entity1", "check1")
+	event.Entity.Labels = map[string]string{"cluster": "eu-1"}
+	event.Check.Labels = map[string]string{"cluster": "eu-2"}
+	assert.Equal(t, `found in entity.metadata.labels="eu-1", check.metadata.labels="eu-2"`, labelSources(event, "cluster"))
+	assert.Equal(t, "not found", labelSources(event, "pod"))
+}
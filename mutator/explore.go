@@ -0,0 +1,178 @@
+package mutator
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/sensu/sensu-go/types"
+)
+
+// ExploreQuery struct describes one query in Grafana Explore
+type ExploreQuery struct {
+	// Datasource is the datasource name in legacy URL or the datasource UID in panes URL
+	Datasource string
+	// DatasourceType is the grafana plugin type. e. loki, prometheus or tempo
+	DatasourceType string
+	// Field is the query field name. e. expr for loki and prometheus, query for tempo
+	Field string
+	Query string
+}
+
+type explorePane struct {
+	Datasource string                   `json:"datasource"`
+	Queries    []map[string]interface{} `json:"queries"`
+	Range      exploreRange             `json:"range"`
+}
+
+type exploreDatasource struct {
+	Type string `json:"type"`
+	UID  string `json:"uid"`
+}
+
+type exploreRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+func lokiExploreQuery(labels map[string]string, matchers []labelMatcher, datasource string) ExploreQuery {
+	return ExploreQuery{Datasource: datasource, DatasourceType: "loki", Field: "expr", Query: logQLQuery(labels, matchers)}
+}
+
+// prometheusExploreQuery creates metric{key="value",...}
+// eventID is only used as loki pipeline, then it is ignored here
+func prometheusExploreQuery(labels map[string]string, metric, datasource string) ExploreQuery {
+	return ExploreQuery{Datasource: datasource, DatasourceType: "prometheus", Field: "expr", Query: fmt.Sprintf("%s%s", metric, streamSelector(labels, nil))}
+}
+
+func tempoExploreQuery(traceID, datasource string) ExploreQuery {
+	return ExploreQuery{Datasource: datasource, DatasourceType: "tempo", Field: "query", Query: traceID}
+}
+
+// grafanaExploreLinkURL creates a grafana explore URL using the version from --grafana-explore-url-version
+func grafanaExploreLinkURL(grafana, version string, q ExploreQuery, fromDate, toDate int64) (string, error) {
+	if version == ExploreURLPanes {
+		return grafanaExplorePanesURL(grafana, fromDate, toDate, q)
+	}
+	return grafanaExploreURL(grafana, q.Datasource, q.Field, q.Query, fromDate, toDate)
+}
+
+// grafanaExplorePanesURL creates a grafana explore URL using schemaVersion=1 and one pane for each query
+func grafanaExplorePanesURL(grafana string, fromDate, toDate int64, queries ...ExploreQuery) (string, error) {
+	// grafana URL expected: https://grafana.com/?orgId=1
+	grafanaURL, err := url.Parse(grafana)
+	if err != nil {
+		return "", err
+	}
+	// if grafana URL not contain "?orgId=1" return a error in the end of this func
+	var errOrgID error
+	if !checkMissingOrgID(grafanaURL.Query()) {
+		errOrgID = fmt.Errorf("Missing orgId in grafana URL. e. https://grafana.com/?orgId=1")
+	}
+	panes := make(map[string]explorePane)
+	for i, q := range queries {
+		query := map[string]interface{}{
+			"refId":      "A",
+			q.Field:      q.Query,
+			"datasource": exploreDatasource{Type: q.DatasourceType, UID: q.Datasource},
+		}
+		panes[string(rune('a'+i))] = explorePane{
+			Datasource: q.Datasource,
+			Queries:    []map[string]interface{}{query},
+			Range:      exploreRange{From: fmt.Sprintf("%d", fromDate), To: fmt.Sprintf("%d", toDate)},
+		}
+	}
+	panesJSON, err := json.Marshal(panes)
+	if err != nil {
+		return "", err
+	}
+	values := grafanaURL.Query()
+	values.Set("schemaVersion", "1")
+	values.Set("panes", string(panesJSON))
+	// keep grafana sub path. e. https://grafana.com/grafana/explore
+	grafanaURL.Path = path.Join("/", grafanaURL.Path, "explore")
+	grafanaURL.RawPath = ""
+	grafanaURL.RawQuery = values.Encode()
+	return grafanaURL.String(), errOrgID
+}
+
+// grafanaExploreSplitURL creates a grafana explore URL in split view with left and right panes
+func grafanaExploreSplitURL(grafana, version string, left, right ExploreQuery, fromDate, toDate int64) (string, error) {
+	if version == ExploreURLPanes {
+		return grafanaExplorePanesURL(grafana, fromDate, toDate, left, right)
+	}
+	grafanaURL, err := grafanaExploreURL(grafana, left.Datasource, left.Field, left.Query, fromDate, toDate)
+	if grafanaURL == "" {
+		return "", err
+	}
+	rightPane := legacyExplorePane(right.Datasource, right.Field, right.Query, fromDate, toDate)
+	return fmt.Sprintf("%s&right=%s", grafanaURL, rightPane), err
+}
+
+// splitExploreQueries returns queries configured in --grafana-explore-split-panes.
+// It returns less than two queries if any of them cannot be created for this event
+func (m *Mutator) splitExploreQueries(event *types.Event, instance GrafanaInstance, labels map[string]string, othersIntegrationsFound string) []ExploreQuery {
+	queries := []ExploreQuery{}
+	for _, pane := range m.config.GrafanaExploreSplitPanes {
+		switch pane {
+		case "loki":
+			if m.lokiLinkApplies(othersIntegrationsFound) {
+				queries = append(queries, lokiExploreQuery(labels, m.lokiStreamMatchers, instance.LokiDatasource))
+			}
+		case "prometheus":
+			if m.prometheusLinkApplies(othersIntegrationsFound) {
+				queries = append(queries, prometheusExploreQuery(labels, m.config.GrafanaPrometheusMetric, instance.PrometheusDatasource))
+			}
+		case "tempo":
+			traceID, found := extractTraceID(event, m.config.TempoTraceIDLabel, m.traceIDRegexp)
+			if found {
+				queries = append(queries, tempoExploreQuery(traceID, instance.TempoDatasource))
+			}
+		}
+	}
+	return queries
+}
+
+func replaceSpecial(s string) string {
+	//  [
+	value := strings.ReplaceAll(s, "[", "%5B")
+	//  ] %5D
+	value = strings.ReplaceAll(value, "]", "%5D")
+	//  " %22
+	value = strings.ReplaceAll(value, "\"", "%22")
+	// { %7B
+	value = strings.ReplaceAll(value, "{", "%7B")
+	// } %7D
+	value = strings.ReplaceAll(value, "}", "%7D")
+	return value
+}
+
+// grafanaExploreURL returns a grafana explore URL using legacy left pane
+// queryField is the datasource query field name. e. expr for loki and prometheus, query for tempo
+func grafanaExploreURL(grafana, datasource, queryField, query string, fromDate, toDate int64) (string, error) {
+	// grafana URL expected: https://grafana.com/?orgId=1
+	grafanaURL, err := url.Parse(grafana)
+	if err != nil {
+		return "", err
+	}
+	// if grafana URL not contain "?orgId=1" return a error in the end of this func
+	var errOrgID error
+	if !checkMissingOrgID(grafanaURL.Query()) {
+		errOrgID = fmt.Errorf("Missing orgId in grafana URL. e. https://grafana.com/?orgId=1")
+	}
+	// keep grafana sub path. e. https://grafana.com/grafana/explore
+	grafanaURL.Path = path.Join("/", grafanaURL.Path, "explore")
+	grafanaURL.RawPath = ""
+	grafanaExploreURL := fmt.Sprintf("%s&left=", grafanaURL)
+	result := fmt.Sprintf("%s%s", grafanaExploreURL, legacyExplorePane(datasource, queryField, query, fromDate, toDate))
+	return result, errOrgID
+}
+
+// legacyExplorePane returns an encoded pane. e. ["from","to","datasource",{"expr":"query"}]
+func legacyExplorePane(datasource, queryField, query string, fromDate, toDate int64) string {
+	searchText := url.QueryEscape(jsonEscape(query))
+	grafanaExploreURI := fmt.Sprintf("[\"%d\",\"%d\",\"%s\",{\"%s\":\"%s\"}]", fromDate, toDate, jsonEscape(datasource), queryField, searchText)
+	return replaceSpecial(grafanaExploreURI)
+}
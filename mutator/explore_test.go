@@ -0,0 +1,147 @@
+package mutator
+
+import (
+	"encoding/json"
+	"net/url"
+	"strings"
+	"testing"
+
+	v2 "github.com/sensu/sensu-go/api/core/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGrafanaExplorePanesURL(t *testing.T) {
+	q := lokiExploreQuery(map[string]string{"namespace": "default", "app": "api"}, nil, "P8E80F9AEF21F6940")
+	result1, err1 := grafanaExplorePanesURL("https://grafana.com/?orgId=1", 1606487400000, 1606487700000, q)
+	assert.NoError(t, err1)
+	parsed, err := url.Parse(result1)
+	assert.NoError(t, err)
+	assert.Equal(t, "/explore", parsed.Path)
+	assert.Equal(t, "1", parsed.Query().Get("schemaVersion"))
+	assert.Equal(t, "1", parsed.Query().Get("orgId"))
+	panes := map[string]explorePane{}
+	err = json.Unmarshal([]byte(parsed.Query().Get("panes")), &panes)
+	assert.NoError(t, err)
+	assert.Equal(t, "P8E80F9AEF21F6940", panes["a"].Datasource)
+	assert.Equal(t, "1606487400000", panes["a"].Range.From)
+	assert.Equal(t, "1606487700000", panes["a"].Range.To)
+	assert.Equal(t, `{app="api",namespace="default"}`, panes["a"].Queries[0]["expr"])
+	assert.Equal(t, "A", panes["a"].Queries[0]["refId"])
+
+	_, err2 := grafanaExplorePanesURL("https://grafana.com/", 1606487400000, 1606487700000, q)
+	assert.Error(t, err2)
+}
+
+func TestGrafanaExploreLinkURL(t *testing.T) {
+	q := tempoExploreQuery("4bf92f3577b34da6a3ce929d0e0e4736", "tempo")
+	result1, err1 := grafanaExploreLinkURL("https://grafana.com/?orgId=1", ExploreURLLegacy, q, 1606487400000, 1606487700000)
+	assert.NoError(t, err1)
+	assert.Contains(t, result1, "&left=")
+	result2, err2 := grafanaExploreLinkURL("https://grafana.com/?orgId=1", ExploreURLPanes, q, 1606487400000, 1606487700000)
+	assert.NoError(t, err2)
+	assert.Contains(t, result2, "panes=")
+	assert.Contains(t, result2, "schemaVersion=1")
+	// grafana sub path is kept, like in dashboard links
+	result3, err3 := grafanaExploreLinkURL("https://grafana.com/grafana-eu/?orgId=2", ExploreURLLegacy, q, 1606487400000, 1606487700000)
+	assert.NoError(t, err3)
+	assert.True(t, strings.HasPrefix(result3, "https://grafana.com/grafana-eu/explore?orgId=2&left="))
+	result4, err4 := grafanaExploreLinkURL("https://grafana.com/grafana-eu?orgId=2", ExploreURLPanes, q, 1606487400000, 1606487700000)
+	assert.NoError(t, err4)
+	assert.True(t, strings.HasPrefix(result4, "https://grafana.com/grafana-eu/explore?orgId=2&panes="))
+}
+
+func TestGrafanaExploreSplitURL(t *testing.T) {
+	left := lokiExploreQuery(map[string]string{"namespace": "default"}, nil, "loki")
+	right := prometheusExploreQuery(map[string]string{"namespace": "default"}, "up", "prometheus")
+	result1, err1 := grafanaExploreSplitURL("https://grafana.com/?orgId=1", ExploreURLLegacy, left, right, 1606487400000, 1606487700000)
+	assert.NoError(t, err1)
+	assert.Contains(t, result1, "&left=%5B%221606487400000%22,%221606487700000%22,%22loki%22")
+	assert.Contains(t, result1, "&right=%5B%221606487400000%22,%221606487700000%22,%22prometheus%22")
+	result2, err2 := grafanaExploreSplitURL("https://grafana.com/?orgId=1", ExploreURLPanes, left, right, 1606487400000, 1606487700000)
+	assert.NoError(t, err2)
+	parsed, _ := url.Parse(result2)
+	panes := map[string]explorePane{}
+	err := json.Unmarshal([]byte(parsed.Query().Get("panes")), &panes)
+	assert.NoError(t, err)
+	assert.Equal(t, "loki", panes["a"].Datasource)
+	assert.Equal(t, "prometheus", panes["b"].Datasource)
+	_, err3 := grafanaExploreSplitURL("https://grafana.com/", ExploreURLLegacy, left, right, 1606487400000, 1606487700000)
+	assert.Error(t, err3)
+}
+
+func TestSplitExploreQueries(t *testing.T) {
+	m := &Mutator{config: Config{
+		GrafanaExploreSplitPanes: []string{"loki", "tempo"},
+		TempoTraceIDLabel:        "trace_id",
+	}}
+	event1 := v2.FixtureEvent("entity1", "check1")
+	labels := map[string]string{"namespace": "default"}
+	queries1 := m.splitExploreQueries(event1, GrafanaInstance{}, labels, "none")
+	assert.Equal(t, 1, len(queries1))
+	event1.Labels["trace_id"] = "4bf92f3577b34da6a3ce929d0e0e4736"
+	queries2 := m.splitExploreQueries(event1, GrafanaInstance{}, labels, "none")
+	assert.Equal(t, 2, len(queries2))
+	assert.Equal(t, "tempo", queries2[1].DatasourceType)
+	m.config.GrafanaExploreSplitPanes = []string{"loki", "prometheus"}
+	m.config.KubernetesIntegrationLabel = "sensu-kubernetes-events"
+	m.config.KubernetesEventsIntegration = true
+	queries3 := m.splitExploreQueries(event1, GrafanaInstance{}, labels, "sensu-kubernetes-events")
+	assert.Equal(t, 1, len(queries3))
+}
+
+// exploreURL creates a legacy explore URL for one query using the same time range in all tests
+func exploreURL(q ExploreQuery, grafana string) (string, error) {
+	return grafanaExploreURL(grafana, q.Datasource, q.Field, q.Query, 1606487400000, 1606487700000)
+}
+
+func TestGrafanaExploreURLEncoded(t *testing.T) {
+	test1map := map[string]string{"app": "eventrouter", "eventID": "test"}
+	test1 := "https://grafana.com/?orgId=1"
+	expected1 := "app%3D%5C%22eventrouter%5C%22%7D%7C%3D%5C%22test"
+	result1, err1 := exploreURL(lokiExploreQuery(test1map, nil, "loki"), test1)
+	assert.NoError(t, err1)
+	assert.Contains(t, result1, expected1)
+	test2map := map[string]string{"app": "eventrouter", "eventID": "test"}
+	test2 := "https://grafana.com/"
+	_, err2 := exploreURL(lokiExploreQuery(test2map, nil, "loki"), test2)
+	assert.Error(t, err2)
+	test3map := map[string]string{"namespace": "spacename"}
+	namespace := "spacename"
+	result3, err3 := exploreURL(lokiExploreQuery(test3map, nil, "loki"), test1)
+	assert.NoError(t, err3)
+	assert.Contains(t, result3, namespace)
+}
+
+func TestGrafanaPrometheusExploreURLEncoded(t *testing.T) {
+	test1map := map[string]string{"namespace": "spacename", "eventID": "test"}
+	test1 := "https://grafana.com/?orgId=1"
+	expected1 := "up%7Bnamespace%3D%5C%22spacename%5C%22%7D"
+	result1, err1 := exploreURL(prometheusExploreQuery(test1map, "up", "prometheus"), test1)
+	assert.NoError(t, err1)
+	assert.Contains(t, result1, expected1)
+	assert.Contains(t, result1, "%22prometheus%22")
+	assert.NotContains(t, result1, "test")
+	test2 := "https://grafana.com/"
+	_, err2 := exploreURL(prometheusExploreQuery(test1map, "up", "prometheus"), test2)
+	assert.Error(t, err2)
+}
+
+func TestGrafanaTempoExploreURLEncoded(t *testing.T) {
+	test1 := "https://grafana.com/?orgId=1"
+	expected1 := "%22tempo%22,%7B%22query%22:%224bf92f3577b34da6a3ce929d0e0e4736%22%7D"
+	result1, err1 := exploreURL(tempoExploreQuery("4bf92f3577b34da6a3ce929d0e0e4736", "tempo"), test1)
+	assert.NoError(t, err1)
+	assert.Contains(t, result1, expected1)
+}
+
+func TestReplaceSpecial(t *testing.T) {
+	test1 := "ads[]{}\""
+	expected1 := "ads%5B%5D%7B%7D%22"
+	result1 := replaceSpecial(test1)
+	assert.NotContains(t, result1, "[")
+	assert.NotContains(t, result1, "]")
+	assert.NotContains(t, result1, "{")
+	assert.NotContains(t, result1, "}")
+	assert.NotContains(t, result1, "\"")
+	assert.Equal(t, result1, expected1)
+}
@@ -0,0 +1,61 @@
+package mutator
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/robertkrimen/otto"
+	"github.com/sensu/sensu-go/types"
+	"github.com/sensu/sensu-go/types/dynamic"
+)
+
+// expressionTimeout limits how long one expression can run
+const expressionTimeout = 100 * time.Millisecond
+
+var errExpressionTimeout = errors.New("expression timeout")
+
+// evaluateExpression runs a sensu filter like javascript expression against the event.
+// e. event.check.status == 2 && event.entity.entity_class == "agent"
+func evaluateExpression(event *types.Event, expression string) (result bool, err error) {
+	vm := otto.New()
+	// console writes to stdout, where the mutated event is written
+	if err := vm.Set("console", otto.UndefinedValue()); err != nil {
+		return false, err
+	}
+	if err := vm.Set("event", dynamic.Synthesize(event)); err != nil {
+		return false, err
+	}
+	vm.Interrupt = make(chan func(), 1)
+	timer := time.AfterFunc(expressionTimeout, func() {
+		vm.Interrupt <- func() {
+			panic(errExpressionTimeout)
+		}
+	})
+	defer timer.Stop()
+	defer func() {
+		if caught := recover(); caught != nil {
+			if caught != errExpressionTimeout {
+				panic(caught)
+			}
+			result = false
+			err = fmt.Errorf("expression %q took more than %v", expression, expressionTimeout)
+		}
+	}()
+	value, err := vm.Run(expression)
+	if err != nil {
+		return false, fmt.Errorf("expression %q: %v", expression, err)
+	}
+	if !value.IsBoolean() {
+		return false, fmt.Errorf("expression %q did not return a boolean", expression)
+	}
+	return value.ToBoolean()
+}
+
+// compileExpression checks a javascript expression syntax without running it
+func compileExpression(expression string) error {
+	if _, err := otto.New().Compile("", expression); err != nil {
+		return fmt.Errorf("expression %q: %v", expression, err)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package mutator
+
+import (
+	"testing"
+
+	v2 "github.com/sensu/sensu-go/api/core/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvaluateExpression(t *testing.T) {
+	event1 := v2.FixtureEvent("entity1", "check-disk-usage")
+	event1.Check.Status = 2
+	event1.Check.Occurrences = 3
+
+	res1, err1 := evaluateExpression(event1, `event.check.status == 2 && event.entity.entity_class == "host"`)
+	assert.NoError(t, err1)
+	assert.True(t, res1)
+
+	res2, err2 := evaluateExpression(event1, `/^check-disk/.test(event.check.name) && event.check.occurrences > 5`)
+	assert.NoError(t, err2)
+	assert.False(t, res2)
+
+	res3, err3 := evaluateExpression(event1, `event.is_incident && event.entity.namespace == "default"`)
+	assert.NoError(t, err3)
+	assert.True(t, res3)
+
+	_, err4 := evaluateExpression(event1, `event.check.status ==`)
+	assert.Error(t, err4)
+
+	_, err5 := evaluateExpression(event1, `event.check.name`)
+	assert.Error(t, err5)
+
+	_, err6 := evaluateExpression(event1, `while (true) {}`)
+	assert.Error(t, err6)
+
+	_, err7 := evaluateExpression(event1, `console.log("test") || true`)
+	assert.Error(t, err7)
+}
@@ -0,0 +1,82 @@
+package mutator
+
+import (
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/sensu/sensu-go/types"
+)
+
+// GrafanaInstance struct is one route in --grafana-instances
+type GrafanaInstance struct {
+	Name                 string            `json:"name" yaml:"name"`
+	MatchLabels          map[string]string `json:"match_labels" yaml:"match_labels"`
+	Namespaces           []string          `json:"namespaces" yaml:"namespaces"`
+	GrafanaURL           string            `json:"grafana_url" yaml:"grafana_url"`
+	LokiDatasource       string            `json:"loki_datasource" yaml:"loki_datasource"`
+	PrometheusDatasource string            `json:"prometheus_datasource" yaml:"prometheus_datasource"`
+	TempoDatasource      string            `json:"tempo_datasource" yaml:"tempo_datasource"`
+}
+
+// defaultGrafanaInstance uses --grafana-url and datasources flags
+func (m *Mutator) defaultGrafanaInstance() GrafanaInstance {
+	return GrafanaInstance{
+		GrafanaURL:           m.config.GrafanaURL,
+		LokiDatasource:       m.config.GrafanaLokiDatasource,
+		PrometheusDatasource: m.config.GrafanaPrometheusDatasource,
+		TempoDatasource:      m.config.GrafanaTempoDatasource,
+	}
+}
+
+// selectGrafanaInstance returns the first grafana instance matching event labels and entity namespace.
+// Empty datasources use the default ones. If nothing matches, it returns the default instance.
+func (m *Mutator) selectGrafanaInstance(event *types.Event) GrafanaInstance {
+	defaultInstance := m.defaultGrafanaInstance()
+	for _, instance := range m.config.GrafanaInstances {
+		if len(instance.MatchLabels) != 0 && !searchMatchLabels(event, instance.MatchLabels) {
+			continue
+		}
+		if len(instance.Namespaces) != 0 && (event.Entity == nil || !containsString(instance.Namespaces, event.Entity.Namespace)) {
+			continue
+		}
+		if instance.LokiDatasource == "" {
+			instance.LokiDatasource = defaultInstance.LokiDatasource
+		}
+		if instance.PrometheusDatasource == "" {
+			instance.PrometheusDatasource = defaultInstance.PrometheusDatasource
+		}
+		if instance.TempoDatasource == "" {
+			instance.TempoDatasource = defaultInstance.TempoDatasource
+		}
+		return instance
+	}
+	return defaultInstance
+}
+
+// rewriteDashboardURL changes scheme, host, sub path and orgId from dashboard URL to use the selected grafana instance.
+// The dashboard path starting in /d/ is kept, any sub path before it is replaced by the instance sub path.
+// The default instance doesn't change dashboard URL.
+func rewriteDashboardURL(dashboardURL *url.URL, instance GrafanaInstance) error {
+	if instance.Name == "" {
+		return nil
+	}
+	grafanaURL, err := url.Parse(instance.GrafanaURL)
+	if err != nil {
+		return err
+	}
+	dashboardURL.Scheme = grafanaURL.Scheme
+	dashboardURL.Host = grafanaURL.Host
+	dashboardPath := dashboardURL.Path
+	if i := strings.Index(dashboardPath, "/d/"); i != -1 {
+		dashboardPath = dashboardPath[i:]
+	}
+	dashboardURL.Path = path.Join("/", grafanaURL.Path, dashboardPath)
+	dashboardURL.RawPath = ""
+	if orgID := grafanaURL.Query().Get("orgId"); orgID != "" {
+		values := dashboardURL.Query()
+		values.Set("orgId", orgID)
+		dashboardURL.RawQuery = values.Encode()
+	}
+	return nil
+}
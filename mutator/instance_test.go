@@ -0,0 +1,75 @@
+package mutator
+
+import (
+	"net/url"
+	"testing"
+
+	v2 "github.com/sensu/sensu-go/api/core/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseGrafanaInstances(t *testing.T) {
+	instances1, err1 := ParseGrafanaInstances(`[{"name":"eu","match_labels":{"cluster":"eu-1"},"grafana_url":"https://grafana-eu.example.com/?orgId=2","loki_datasource":"loki-eu"}]`)
+	assert.NoError(t, err1)
+	assert.Empty(t, validateGrafanaInstances(instances1))
+	assert.Equal(t, 1, len(instances1))
+	assert.Equal(t, "loki-eu", instances1[0].LokiDatasource)
+	instances2, err2 := ParseGrafanaInstances("")
+	assert.NoError(t, err2)
+	assert.Equal(t, 0, len(instances2))
+	instances3, _ := ParseGrafanaInstances(`[{"name":"eu","match_labels":{"cluster":"eu-1"},"grafana_url":"https://grafana-eu.example.com/"}]`)
+	assert.NotEmpty(t, validateGrafanaInstances(instances3))
+	instances4, _ := ParseGrafanaInstances(`[{"name":"eu","grafana_url":"https://grafana-eu.example.com/?orgId=1"}]`)
+	assert.NotEmpty(t, validateGrafanaInstances(instances4))
+	instances5, _ := ParseGrafanaInstances(`[{"match_labels":{"cluster":"eu-1"},"grafana_url":"https://grafana-eu.example.com/?orgId=1"}]`)
+	assert.NotEmpty(t, validateGrafanaInstances(instances5))
+	_, err6 := ParseGrafanaInstances(`{`)
+	assert.Error(t, err6)
+	_, err7 := ParseGrafanaInstances(`[{"name":"eu","grafana":"https://grafana-eu.example.com/?orgId=1"}]`)
+	assert.Error(t, err7)
+}
+
+func TestSelectGrafanaInstance(t *testing.T) {
+	m := &Mutator{config: Config{
+		GrafanaURL:            "https://grafana.example.com/?orgId=1",
+		GrafanaLokiDatasource: "loki",
+		GrafanaInstances: []GrafanaInstance{
+			{Name: "eu", MatchLabels: map[string]string{"cluster": "eu-1"}, GrafanaURL: "https://grafana-eu.example.com/?orgId=2", LokiDatasource: "loki-eu"},
+			{Name: "us", Namespaces: []string{"us"}, GrafanaURL: "https://grafana-us.example.com/?orgId=3"},
+		},
+	}}
+	event1 := v2.FixtureEvent("entity1", "check1")
+	event1.Labels["cluster"] = "eu-1"
+	instance1 := m.selectGrafanaInstance(event1)
+	assert.Equal(t, "eu", instance1.Name)
+	assert.Equal(t, "loki-eu", instance1.LokiDatasource)
+	event2 := v2.FixtureEvent("entity2", "check2")
+	event2.Entity.Namespace = "us"
+	instance2 := m.selectGrafanaInstance(event2)
+	assert.Equal(t, "us", instance2.Name)
+	assert.Equal(t, "loki", instance2.LokiDatasource)
+	event3 := v2.FixtureEvent("entity3", "check3")
+	instance3 := m.selectGrafanaInstance(event3)
+	assert.Equal(t, "", instance3.Name)
+	assert.Equal(t, "https://grafana.example.com/?orgId=1", instance3.GrafanaURL)
+}
+
+func TestRewriteDashboardURL(t *testing.T) {
+	dashboardURL1, _ := url.Parse("https://grafana.example.com/d/3138fa155d5915769fbded898ac09fd9/kubernetes-kubelet?orgId=1&var-datasource=thanos")
+	err1 := rewriteDashboardURL(dashboardURL1, GrafanaInstance{Name: "eu", GrafanaURL: "https://grafana-eu.example.com/?orgId=2"})
+	assert.NoError(t, err1)
+	assert.Equal(t, "https://grafana-eu.example.com/d/3138fa155d5915769fbded898ac09fd9/kubernetes-kubelet?orgId=2&var-datasource=thanos", dashboardURL1.String())
+	dashboardURL2, _ := url.Parse("https://grafana.example.com/d/3138fa155d5915769fbded898ac09fd9/kubernetes-kubelet?orgId=1")
+	err2 := rewriteDashboardURL(dashboardURL2, GrafanaInstance{GrafanaURL: "https://grafana-eu.example.com/?orgId=2"})
+	assert.NoError(t, err2)
+	assert.Equal(t, "https://grafana.example.com/d/3138fa155d5915769fbded898ac09fd9/kubernetes-kubelet?orgId=1", dashboardURL2.String())
+	// instance sub path replaces default grafana sub path
+	dashboardURL3, _ := url.Parse("https://grafana.example.com/grafana/d/3138fa155d5915769fbded898ac09fd9/kubernetes-kubelet?orgId=1")
+	err3 := rewriteDashboardURL(dashboardURL3, GrafanaInstance{Name: "eu", GrafanaURL: "https://grafana.example.com/grafana-eu/?orgId=2"})
+	assert.NoError(t, err3)
+	assert.Equal(t, "https://grafana.example.com/grafana-eu/d/3138fa155d5915769fbded898ac09fd9/kubernetes-kubelet?orgId=2", dashboardURL3.String())
+	dashboardURL4, _ := url.Parse("https://grafana.example.com/dashboard/db/kubelet?orgId=1")
+	err4 := rewriteDashboardURL(dashboardURL4, GrafanaInstance{Name: "eu", GrafanaURL: "https://grafana.example.com/grafana-eu?orgId=2"})
+	assert.NoError(t, err4)
+	assert.Equal(t, "https://grafana.example.com/grafana-eu/dashboard/db/kubelet?orgId=2", dashboardURL4.String())
+}
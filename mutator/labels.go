@@ -0,0 +1,253 @@
+package mutator
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/sensu/sensu-go/types"
+)
+
+func extractLabels(event *types.Event, label string) (string, bool) {
+	labelFound := ""
+	if event.Labels != nil {
+		for k, v := range event.Labels {
+			if k == label {
+				labelFound = v
+			}
+		}
+	}
+	if event.Entity.Labels != nil {
+		for k, v := range event.Entity.Labels {
+			if k == label {
+				labelFound = v
+			}
+		}
+	}
+	if event.Check.Labels != nil {
+		for k, v := range event.Check.Labels {
+			if k == label {
+				labelFound = v
+			}
+		}
+	}
+	if labelFound == "" {
+		return labelFound, false
+	}
+	return labelFound, true
+}
+
+// extractTraceID looks for a trace ID in sensu label first and then in check output
+func extractTraceID(event *types.Event, label string, re *regexp.Regexp) (string, bool) {
+	if label != "" {
+		value, found := extractLabels(event, label)
+		if found && validTraceID(value) {
+			return strings.ToLower(value), true
+		}
+	}
+	if re == nil || event.Check == nil || event.Check.Output == "" {
+		return "", false
+	}
+	match := re.FindStringSubmatch(event.Check.Output)
+	if match == nil {
+		return "", false
+	}
+	value := match[0]
+	if len(match) > 1 {
+		value = match[1]
+	}
+	if !validTraceID(value) {
+		return "", false
+	}
+	return strings.ToLower(value), true
+}
+
+// validTraceID accepts 64 bits or 128 bits hexadecimal trace IDs
+func validTraceID(s string) bool {
+	if len(s) != 16 && len(s) != 32 {
+		return false
+	}
+	for _, c := range strings.ToLower(s) {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *Mutator) labelsToSearch() []string {
+	labels := append([]string{}, m.config.ExtraLokiLabels...)
+	if m.config.KubernetesEventsIntegration {
+		labels = append(labels, m.config.KubernetesEventsStreamNamespace)
+		labels = append(labels, m.config.KubernetesEventsPipeline)
+	}
+	labels = append(labels, m.config.DefaultLokiLabelNamespace)
+	if m.config.SensuLabelSelector != m.config.DefaultLokiLabelNamespace {
+		labels = append(labels, m.config.SensuLabelSelector)
+	}
+	if m.config.AlertmanagerEventsIntegration {
+		labels = append(labels, m.config.DefaultIntegrationsLabelNode)
+	}
+	return labels
+}
+
+func (m *Mutator) renameKey(s string) string {
+	switch {
+	case s == m.config.KubernetesEventsStreamNamespace:
+		return m.config.DefaultLokiLabelNamespace
+	case s == m.config.KubernetesEventsPipeline:
+		return "eventID"
+	case s == m.config.SensuLabelSelector:
+		return m.config.DefaultLokiLabelNamespace
+	case s == m.config.DefaultIntegrationsLabelNode:
+		return m.config.DefaultLokiLabelHostname
+	default:
+		return s
+	}
+}
+
+func (m *Mutator) extractLokiLabels(event *types.Event, labels []string) (map[string]string, string) {
+	labelsFound := make(map[string]string)
+	othersIntegrationsFound := "none"
+	var hostnameFound bool
+	for _, l := range labels {
+		// [m.config.KubernetesIntegrationLabel] == "owner"
+		if event.Labels != nil {
+			for k, v := range event.Labels {
+				if k == l {
+					key := m.renameKey(k)
+					labelsFound[key] = v
+				}
+			}
+		}
+		if event.Entity.Labels != nil {
+			for k, v := range event.Entity.Labels {
+				if k == l {
+					key := m.renameKey(k)
+					labelsFound[key] = v
+				}
+			}
+		}
+		// [m.config.AlertmanagerIntegrationLabel] == "owner"
+		if event.Check.Labels != nil {
+			for k, v := range event.Check.Labels {
+				if k == l {
+					key := m.renameKey(k)
+					value := v
+					if k == m.config.DefaultIntegrationsLabelNode {
+						// if doesnt find namespace in labels, use hostname = node
+						// in Loki every node is labeled as hostname
+						// in alert manager/kubernetes the label is node and it used a FQDN
+						// example: ip-10-192-172-1.eu-west-1.compute.internal
+						if strings.Contains(value, ".") {
+							newapp := strings.Split(value, ".")
+							value = newapp[0]
+							hostnameFound = true
+						}
+					}
+					labelsFound[key] = value
+				}
+				if k == m.config.AlertmanagerIntegrationLabel && v == "owner" {
+					othersIntegrationsFound = m.config.AlertmanagerIntegrationLabel
+				}
+			}
+		}
+	}
+	if hostnameFound && event.Check.Labels[m.config.AlertmanagerIntegrationLabel] == "owner" {
+		onlyHostnameLabel := make(map[string]string)
+		onlyHostnameLabel[m.config.DefaultLokiLabelHostname] = labelsFound[m.config.DefaultLokiLabelHostname]
+		return onlyHostnameLabel, m.config.AlertmanagerIntegrationLabel
+	}
+	if event.Labels[m.config.KubernetesIntegrationLabel] == "owner" {
+		k8sEventsLabel := map[string]string{m.config.KubernetesEventsStreamLabel: m.config.KubernetesEventsStreamSelector}
+		k8sEventsLabel["eventID"] = labelsFound["eventID"]
+		return k8sEventsLabel, m.config.KubernetesIntegrationLabel
+	}
+	return labelsFound, othersIntegrationsFound
+}
+
+func generateURIBySlice(event *types.Event, v []string) (string, bool) {
+	return generateURIBySliceWithVariables(event, v, nil)
+}
+
+// generateURIBySliceWithVariables uses variables map (label -> grafana variable name) to rename a label
+// e. {"hostname": "instance"} creates &var-instance=hostname.value
+func generateURIBySliceWithVariables(event *types.Event, v []string, variables map[string]string) (string, bool) {
+	count := 0
+	finalURI := ""
+	for _, s := range v {
+		// &var-namespace=test
+		value, validFinalURI := extractLabels(event, s)
+		if validFinalURI {
+			variable := s
+			if variables[s] != "" {
+				variable = variables[s]
+			}
+			finalURI += fmt.Sprintf("&var-%s=%s", variable, value)
+			count++
+		}
+	}
+	if len(v) == count {
+		return finalURI, true
+	}
+	return "", false
+}
+
+// generateURIByAutoVariables adds &var-name=value for dashboard template variables found in event labels,
+// skipping variables already filled by labels and variables
+func generateURIByAutoVariables(event *types.Event, v DashboardSuggested, autoVariables []string) string {
+	finalURI := ""
+	for _, variable := range autoVariables {
+		if autoVariableFilled(v, variable) {
+			continue
+		}
+		if value, found := extractLabels(event, variable); found {
+			finalURI += fmt.Sprintf("&var-%s=%s", variable, value)
+		}
+	}
+	return finalURI
+}
+
+func autoVariableFilled(v DashboardSuggested, variable string) bool {
+	for _, label := range v.Labels {
+		if v.Variables[label] == variable || (v.Variables[label] == "" && label == variable) {
+			return true
+		}
+	}
+	return false
+}
+
+func searchMatchLabels(event *types.Event, labels map[string]string) bool {
+	if len(labels) == 0 {
+		return false
+	}
+	count := 0
+	for key, value := range labels {
+		if event.Labels != nil {
+			for k, v := range event.Labels {
+				if k == key && v == value {
+					count++
+				}
+			}
+		}
+		if event.Entity.Labels != nil {
+			for k, v := range event.Entity.Labels {
+				if k == key && v == value {
+					count++
+				}
+			}
+		}
+		if event.Check.Labels != nil {
+			for k, v := range event.Check.Labels {
+				if k == key && v == value {
+					count++
+				}
+			}
+		}
+		if count == len(labels) {
+			return true
+		}
+	}
+
+	return false
+}
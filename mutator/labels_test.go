@@ -0,0 +1,108 @@
+package mutator
+
+import (
+	"regexp"
+	"testing"
+
+	v2 "github.com/sensu/sensu-go/api/core/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractTraceID(t *testing.T) {
+	re := regexp.MustCompile(DefaultTraceIDRegex)
+	event1 := v2.FixtureEvent("entity1", "check1")
+	event1.Labels["trace_id"] = "4BF92F3577B34DA6A3CE929D0E0E4736"
+	value1, result1 := extractTraceID(event1, "trace_id", re)
+	assert.True(t, result1)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", value1)
+	event2 := v2.FixtureEvent("entity2", "check2")
+	event2.Check.Output = "HTTP CRITICAL: 500 traceparent: 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	value2, result2 := extractTraceID(event2, "trace_id", re)
+	assert.True(t, result2)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", value2)
+	event3 := v2.FixtureEvent("entity3", "check3")
+	event3.Check.Output = "X-B3-TraceId: 80f198ee56343ba864fe8b2a57d3eff7"
+	value3, result3 := extractTraceID(event3, "", re)
+	assert.True(t, result3)
+	assert.Equal(t, "80f198ee56343ba864fe8b2a57d3eff7", value3)
+	event4 := v2.FixtureEvent("entity4", "check4")
+	event4.Check.Output = "uber-trace-id: 00f067aa0ba902b7:00f067aa0ba902b7:0:1"
+	value4, result4 := extractTraceID(event4, "", re)
+	assert.True(t, result4)
+	assert.Equal(t, "00f067aa0ba902b7", value4)
+	event5 := v2.FixtureEvent("entity5", "check5")
+	event5.Check.Output = "HTTP OK"
+	_, result5 := extractTraceID(event5, "trace_id", re)
+	assert.False(t, result5)
+}
+
+func TestExtractLabels(t *testing.T) {
+	event1 := v2.FixtureEvent("entity1", "check1")
+	event1.Labels["test1"] = "value1"
+	value1, result1 := extractLabels(event1, "test1")
+	assert.Contains(t, value1, "value1")
+	assert.True(t, result1)
+	event2 := v2.FixtureEvent("entity2", "check2")
+	_, result2 := extractLabels(event2, "test2")
+	assert.False(t, result2)
+}
+
+func TestGenerateURIBySlice(t *testing.T) {
+	labels := []string{"testa", "testb"}
+	event1 := v2.FixtureEvent("entity1", "check1")
+	event1.Labels["testa"] = "valuea"
+	event1.Labels["testb"] = "valueb"
+	expected1 := "&var-testa=valuea&var-testb=valueb"
+	result1, res1 := generateURIBySlice(event1, labels)
+	assert.True(t, res1)
+	assert.Contains(t, result1, expected1)
+	event2 := v2.FixtureEvent("entity2", "check2")
+	event2.Labels["testa"] = "valuea"
+	event2.Labels["testb"] = "valueb"
+	_, res2 := generateURIBySlice(event1, labels)
+	assert.True(t, res2)
+}
+
+func TestGenerateURIBySliceWithVariables(t *testing.T) {
+	labels := []string{"hostname", "service", "cluster"}
+	variables := map[string]string{"hostname": "instance", "service": "job"}
+	event1 := v2.FixtureEvent("entity1", "check1")
+	event1.Labels["hostname"] = "host1"
+	event1.Labels["service"] = "api"
+	event1.Labels["cluster"] = "main"
+	expected1 := "&var-instance=host1&var-job=api&var-cluster=main"
+	result1, res1 := generateURIBySliceWithVariables(event1, labels, variables)
+	assert.True(t, res1)
+	assert.Equal(t, expected1, result1)
+	event2 := v2.FixtureEvent("entity2", "check2")
+	event2.Labels["hostname"] = "host1"
+	_, res2 := generateURIBySliceWithVariables(event2, labels, variables)
+	assert.False(t, res2)
+}
+
+func TestSearchMatchLabels(t *testing.T) {
+	event1 := v2.FixtureEvent("entity1", "check1")
+	event1.Labels["testa"] = "valuea"
+	event1.Labels["testb"] = "valueb"
+	event1.Labels["testc"] = "valuec"
+	labels := make(map[string]string)
+	res1 := searchMatchLabels(event1, labels)
+	assert.False(t, res1)
+
+	labels["testa"] = "valuea"
+	labels["testc"] = "valuec"
+	res2 := searchMatchLabels(event1, labels)
+	assert.True(t, res2)
+
+}
+
+func TestGenerateURIByAutoVariables(t *testing.T) {
+	event1 := v2.FixtureEvent("entity1", "check1")
+	event1.Labels["hostname"] = "host1"
+	event1.Labels["cluster"] = "main"
+	event1.Labels["pod"] = "api-1"
+	v := DashboardSuggested{Labels: []string{"hostname", "pod"}, Variables: map[string]string{"hostname": "instance"}}
+	result1 := generateURIByAutoVariables(event1, v, []string{"instance", "cluster", "pod", "namespace"})
+	assert.Equal(t, "&var-cluster=main", result1)
+	assert.Equal(t, "", generateURIByAutoVariables(event1, v, nil))
+}
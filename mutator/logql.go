@@ -0,0 +1,69 @@
+package mutator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// streamSelector creates a LogQL (or PromQL) stream selector with labels sorted by name
+// and values escaped as LogQL strings. Extra matchers are added after labels in the same order.
+// e. {cluster="main",namespace="default",container!="istio-proxy"}
+func streamSelector(labels map[string]string, matchers []labelMatcher) string {
+	keys := make([]string, 0, len(labels))
+	for key, value := range labels {
+		if key != "" && value != "" && key != "eventID" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	selectors := make([]string, 0, len(keys)+len(matchers))
+	for _, key := range keys {
+		selectors = append(selectors, fmt.Sprintf("%s=%s", key, strconv.Quote(labels[key])))
+	}
+	for _, m := range matchers {
+		selectors = append(selectors, fmt.Sprintf("%s%s%s", m.Key, m.Op, strconv.Quote(m.Values[0])))
+	}
+	return fmt.Sprintf("{%s}", strings.Join(selectors, ","))
+}
+
+// logQLQuery adds a line filter using eventID label if it exists. e. {app="eventrouter"}|="eventID"
+func logQLQuery(labels map[string]string, matchers []labelMatcher) string {
+	query := streamSelector(labels, matchers)
+	if labels["eventID"] != "" {
+		query += fmt.Sprintf("|=%s", strconv.Quote(labels["eventID"]))
+	}
+	return query
+}
+
+// parseStreamMatchers parses a comma separated list of LogQL matchers. e. container!="istio-proxy",pod=~"api-.*"
+func parseStreamMatchers(s string) ([]labelMatcher, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	matchers, err := parseSelector(s)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range matchers {
+		switch m.Op {
+		case "=", "!=", "=~", "!~":
+		default:
+			return nil, fmt.Errorf("invalid stream matcher %s: only =, !=, =~ and !~ are allowed", m.Key)
+		}
+	}
+	return matchers, nil
+}
+
+// jsonEscape escapes s to be used inside a json string without html escaping
+func jsonEscape(s string) string {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	_ = encoder.Encode(s)
+	value := strings.TrimSuffix(buf.String(), "\n")
+	return value[1 : len(value)-1]
+}
@@ -0,0 +1,50 @@
+package mutator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamSelector(t *testing.T) {
+	labels := map[string]string{"pod": "api-1", "namespace": "default", "cluster": "main", "eventID": "id", "empty": ""}
+	expected1 := `{cluster="main",namespace="default",pod="api-1"}`
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, expected1, streamSelector(labels, nil))
+	}
+	escaped := map[string]string{"msg": `say "hi" \ bye`}
+	assert.Equal(t, `{msg="say \"hi\" \\ bye"}`, streamSelector(escaped, nil))
+	matchers, err := parseStreamMatchers(`container!="istio-proxy",pod=~"api-.*"`)
+	assert.NoError(t, err)
+	expected3 := `{namespace="default",container!="istio-proxy",pod=~"api-.*"}`
+	assert.Equal(t, expected3, streamSelector(map[string]string{"namespace": "default"}, matchers))
+}
+
+func TestLogQLQuery(t *testing.T) {
+	labels := map[string]string{"app": "eventrouter", "eventID": `nginx.164c27e81b96bdc8`}
+	assert.Equal(t, `{app="eventrouter"}|="nginx.164c27e81b96bdc8"`, logQLQuery(labels, nil))
+}
+
+func TestParseStreamMatchers(t *testing.T) {
+	matchers1, err1 := parseStreamMatchers("")
+	assert.NoError(t, err1)
+	assert.Nil(t, matchers1)
+	_, err2 := parseStreamMatchers("namespace in (a,b)")
+	assert.Error(t, err2)
+	_, err3 := parseStreamMatchers("pod")
+	assert.Error(t, err3)
+
+	// quoted values are unquoted like LogQL strings, then they are the same in the stream selector
+	matchers4, err4 := parseStreamMatchers(`pod=~"api-\\d+",msg!="say \"hi\", bye"`)
+	assert.NoError(t, err4)
+	assert.Equal(t, `api-\d+`, matchers4[0].Values[0])
+	assert.True(t, matchers4[0].Regex.MatchString("api-12"))
+	assert.Equal(t, `say "hi", bye`, matchers4[1].Values[0])
+	assert.Equal(t, `{pod=~"api-\\d+",msg!="say \"hi\", bye"}`, streamSelector(nil, matchers4))
+	_, err5 := parseStreamMatchers(`pod=~"api-\d+"`)
+	assert.Error(t, err5)
+}
+
+func TestJSONEscape(t *testing.T) {
+	assert.Equal(t, `{app=\"a&b\"}`, jsonEscape(`{app="a&b"}`))
+}
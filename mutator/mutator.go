@@ -0,0 +1,498 @@
+// Package mutator creates Grafana Dashboards and Grafana Explore links for Sensu events.
+//
+// It is used by sensu-grafana-mutator command and can be imported by other Sensu plugins:
+//
+//	m, err := mutator.New(config)
+//	links, err := m.Links(event)
+package mutator
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/sensu/sensu-go/types"
+)
+
+const (
+	// ExploreURLLegacy uses explore?orgId=1&left=["from","to","datasource",{"expr":"query"}]
+	ExploreURLLegacy = "legacy"
+	// ExploreURLPanes uses explore?schemaVersion=1&orgId=1&panes={"a":{"datasource":"uid",...}}
+	ExploreURLPanes = "panes"
+	// DefaultTraceIDRegex matches W3C traceparent, B3, Jaeger uber-trace-id and trace_id=<id> formats
+	DefaultTraceIDRegex = `(?i)(?:traceparent[:=]\s*"?[0-9a-f]{2}-|x-b3-traceid[:=]\s*"?|b3[:=]\s*"?|uber-trace-id[:=]\s*"?|trace[_-]?id[:=]\s*"?)([0-9a-f]{16,32})`
+)
+
+// DashboardSuggested struct
+type DashboardSuggested struct {
+	GrafanaAnnotation string            `json:"grafana_annotation" yaml:"grafana_annotation"`
+	DashboardURL      string            `json:"dashboard_url" yaml:"dashboard_url"`
+	Labels            []string          `json:"labels" yaml:"labels"`
+	MatchLabels       map[string]string `json:"match_labels" yaml:"match_labels"`
+	Variables         map[string]string `json:"variables" yaml:"variables"`
+	MatchSelectors    []string          `json:"match_selectors" yaml:"match_selectors"`
+	Expression        string            `json:"expression" yaml:"expression"`
+	// DashboardUID, DashboardTitle or DashboardTag are used instead of DashboardURL to find it using grafana HTTP API
+	DashboardUID   string `json:"dashboard_uid" yaml:"dashboard_uid"`
+	DashboardTitle string `json:"dashboard_title" yaml:"dashboard_title"`
+	DashboardTag   string `json:"dashboard_tag" yaml:"dashboard_tag"`
+	// DashboardFile is a dashboard JSON model exported from grafana, used for auto_variables and, without dashboard_url, to create it
+	DashboardFile string `json:"dashboard_file" yaml:"dashboard_file"`
+	// AutoVariables adds &var-name=value for each dashboard template variable found in event labels
+	AutoVariables bool `json:"auto_variables" yaml:"auto_variables"`
+	// PanelID or PanelTitle adds &viewPanel=<id> to open only one panel, Panels chooses other panels by alertname or check name
+	PanelID    int              `json:"panel_id" yaml:"panel_id"`
+	PanelTitle string           `json:"panel_title" yaml:"panel_title"`
+	Panels     []DashboardPanel `json:"panels" yaml:"panels"`
+}
+
+// DashboardPanel struct chooses a panel for events with this alertname label or check name
+type DashboardPanel struct {
+	Alertname  string `json:"alertname" yaml:"alertname"`
+	CheckName  string `json:"check_name" yaml:"check_name"`
+	PanelID    int    `json:"panel_id" yaml:"panel_id"`
+	PanelTitle string `json:"panel_title" yaml:"panel_title"`
+}
+
+// Config struct has the same options as sensu-grafana-mutator flags, already parsed.
+// Use DefaultConfig to start with the same default values.
+type Config struct {
+	// Name is used in error annotations. e. sensu-grafana-mutator/errors
+	Name string
+	// Keyspace is used in dashboard-suggested-add and dashboard-suggested-disable annotations
+	Keyspace                        string
+	GrafanaURL                      string
+	GrafanaInstances                []GrafanaInstance
+	GrafanaDashboardSuggested       []DashboardSuggested
+	GrafanaExploreLinkEnabled       bool
+	GrafanaLokiDatasource           string
+	GrafanaExploreURLVersion        string
+	GrafanaExploreSplitEnabled      bool
+	GrafanaExploreSplitPanes        []string
+	GrafanaPrometheusLinkEnabled    bool
+	GrafanaPrometheusDatasource     string
+	GrafanaPrometheusMetric         string
+	GrafanaTempoLinkEnabled         bool
+	GrafanaTempoDatasource          string
+	TempoTraceIDLabel               string
+	TempoTraceIDRegex               string
+	SensuLabelSelector              string
+	KubernetesIntegrationLabel      string
+	KubernetesEventsIntegration     bool
+	KubernetesEventsStreamLabel     string
+	KubernetesEventsStreamSelector  string
+	KubernetesEventsPipeline        string
+	KubernetesEventsStreamNamespace string
+	AlertmanagerEventsIntegration   bool
+	AlertmanagerIntegrationLabel    string
+	DefaultLokiLabelNamespace       string
+	DefaultLokiLabelHostname        string
+	DefaultIntegrationsLabelNode    string
+	ExtraLokiLabels                 []string
+	LokiStreamMatchers              string
+	// AlwaysReturnEvent returns events that cannot be mutated without error. Link errors never return an error
+	AlwaysReturnEvent bool
+	// GrafanaAPIToken is used to find dashboards by uid, title or tag in --grafana-url
+	GrafanaAPIToken string
+	// GrafanaAPIURLs are the only grafana URLs that receive GrafanaAPIToken, then URLs from event annotations
+	// overrides cannot get it. Empty uses GrafanaURL and GrafanaInstances, WithConfig keeps the previous list
+	GrafanaAPIURLs []string
+	// GrafanaAPICacheFile keeps dashboards found using grafana API between executions. Empty uses only memory
+	GrafanaAPICacheFile string
+	GrafanaAPICacheTTL  time.Duration
+	// GrafanaDashboardsDir has provisioned dashboards JSON files, dashboards tagged with GrafanaDashboardsTag
+	// are added to GrafanaDashboardSuggested using their template variables as labels
+	GrafanaDashboardsDir string
+	GrafanaDashboardsTag string
+	// GrafanaRenderImages adds grafana_<name>_image_url for dashboards with a panel, using grafana image renderer
+	GrafanaRenderImages   bool
+	GrafanaRenderWidth    int
+	GrafanaRenderHeight   int
+	GrafanaRenderTheme    string
+	GrafanaRenderTimezone string
+	// LinkProviders enables providers added by RegisterProvider. Built-in providers are enabled by their own options
+	LinkProviders []string
+	TimeRange     time.Duration
+	// RuleObserver is called for each dashboard suggested with its rule name and if it matched. It can be nil.
+	RuleObserver func(rule string, matched bool)
+	// LinkObserver is called for each link created or failed by Links with its rule name. It can be nil.
+	LinkObserver func(rule string, created bool)
+}
+
+// Link struct is one link created for an event
+type Link struct {
+	// Name is the annotation name. e. grafana_loki_url
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	// Rule is the configured dashboard rule, before rendering templates, or the provider name. Links sets it
+	// to the provider name if empty. Rendered names can have any label value, then Rule is used to count links
+	Rule string `json:"-"`
+}
+
+// LinkError struct is one entry in sensu-grafana-mutator/errors annotation
+type LinkError struct {
+	Name   string `json:"name"`
+	Reason string `json:"reason"`
+	// Rule is the configured dashboard rule, before rendering templates, or the provider name. Links sets it
+	// to the provider name if empty. Rendered names can have any label value, then Rule is used to count links
+	Rule string `json:"-"`
+}
+
+// LinkErrors is returned by Links when one or more links failed
+type LinkErrors []LinkError
+
+func (e LinkErrors) Error() string {
+	messages := []string{}
+	for _, linkError := range e {
+		messages = append(messages, fmt.Sprintf("%s: %s", linkError.Name, linkError.Reason))
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Mutator creates links using only its own Config, it is safe for concurrent use
+type Mutator struct {
+	config             Config
+	traceIDRegexp      *regexp.Regexp
+	lokiStreamMatchers []labelMatcher
+	providers          []LinkProvider
+	resolver           *dashboardResolver
+	// indexed has all dashboards found in --grafana-dashboards-dir and provisioned
+	// only those not replaced by --grafana-dashboard-suggested
+	indexed     []DashboardSuggested
+	provisioned []DashboardSuggested
+}
+
+// DefaultConfig returns sensu-grafana-mutator flags default values
+func DefaultConfig() Config {
+	return Config{
+		Name:                            "sensu-grafana-mutator",
+		Keyspace:                        "sensu.io/plugins/sensu-grafana-mutator/config",
+		GrafanaLokiDatasource:           "loki",
+		GrafanaExploreURLVersion:        ExploreURLLegacy,
+		GrafanaExploreSplitPanes:        []string{"loki", "prometheus"},
+		GrafanaPrometheusDatasource:     "prometheus",
+		GrafanaPrometheusMetric:         "up",
+		GrafanaTempoDatasource:          "tempo",
+		TempoTraceIDLabel:               "trace_id",
+		TempoTraceIDRegex:               DefaultTraceIDRegex,
+		SensuLabelSelector:              "kubernetes_namespace",
+		KubernetesIntegrationLabel:      "sensu-kubernetes-events",
+		KubernetesEventsStreamLabel:     "app",
+		KubernetesEventsStreamSelector:  "eventrouter",
+		KubernetesEventsPipeline:        "io.kubernetes.event.id",
+		KubernetesEventsStreamNamespace: "io.kubernetes.event.namespace",
+		AlertmanagerIntegrationLabel:    "sensu-alertmanager-events",
+		DefaultLokiLabelNamespace:       "namespace",
+		DefaultLokiLabelHostname:        "hostname",
+		DefaultIntegrationsLabelNode:    "node",
+		ExtraLokiLabels:                 []string{"cluster", "pod"},
+		GrafanaAPICacheTTL:              time.Hour,
+		GrafanaDashboardsTag:            DefaultDashboardsTag,
+		GrafanaRenderWidth:              1000,
+		GrafanaRenderHeight:             500,
+		GrafanaRenderTheme:              "light",
+		GrafanaRenderTimezone:           "UTC",
+		TimeRange:                       300 * time.Second,
+	}
+}
+
+// New validates config and returns a Mutator. All problems found, including invalid dashboards
+// in --grafana-dashboards-dir, are returned as Problems.
+func New(config Config) (*Mutator, error) {
+	indexed, problems := config.validate(true)
+	if len(problems) != 0 {
+		return nil, Problems(problems)
+	}
+	return newMutator(config, indexed), nil
+}
+
+// WithConfig validates config and returns a new Mutator, e.g. using one event overrides.
+// Dashboards found in --grafana-dashboards-dir are reused if the directory and tag didn't change.
+func (m *Mutator) WithConfig(config Config) (*Mutator, error) {
+	sameDir := config.GrafanaDashboardsDir == m.config.GrafanaDashboardsDir && config.GrafanaDashboardsTag == m.config.GrafanaDashboardsTag
+	indexed, problems := config.validate(!sameDir)
+	if len(problems) != 0 {
+		return nil, Problems(problems)
+	}
+	if sameDir {
+		indexed = m.indexed
+	}
+	if len(config.GrafanaAPIURLs) == 0 {
+		config.GrafanaAPIURLs = m.config.grafanaAPIURLs()
+	}
+	return newMutator(config, indexed), nil
+}
+
+// newMutator returns a Mutator using a valid config and dashboards already indexed
+func newMutator(config Config, indexed []DashboardSuggested) *Mutator {
+	m := &Mutator{config: config, resolver: newDashboardResolver(config), indexed: indexed}
+	if config.GrafanaTempoLinkEnabled || containsString(config.GrafanaExploreSplitPanes, "tempo") {
+		m.traceIDRegexp = regexp.MustCompile(config.TempoTraceIDRegex)
+	}
+	m.lokiStreamMatchers, _ = parseStreamMatchers(config.LokiStreamMatchers)
+	m.provisioned = withoutConfigured(indexed, config.GrafanaDashboardSuggested)
+	m.providers = m.newProviders()
+	return m
+}
+
+// grafanaAPIURLs returns GrafanaAPIURLs or, if empty, GrafanaURL and GrafanaInstances URLs
+func (c Config) grafanaAPIURLs() []string {
+	if len(c.GrafanaAPIURLs) != 0 {
+		return c.GrafanaAPIURLs
+	}
+	urls := []string{c.GrafanaURL}
+	for _, instance := range c.GrafanaInstances {
+		urls = append(urls, instance.GrafanaURL)
+	}
+	return urls
+}
+
+// Config returns a copy of mutator config
+func (m *Mutator) Config() Config {
+	return m.config
+}
+
+// ErrorsAnnotation returns the annotation name with all errors as a json list
+func (m *Mutator) ErrorsAnnotation() string {
+	return fmt.Sprintf("%s/errors", m.config.Name)
+}
+
+// ErrorAnnotation returns the annotation name with all errors in one message
+func (m *Mutator) ErrorAnnotation() string {
+	return fmt.Sprintf("%s/error", m.config.Name)
+}
+
+// Links returns all links created for an event. Each link provider is used independently:
+// if any link fails, all other links are returned with a LinkErrors error.
+// The event is not changed. Links and link errors without Rule use the provider name.
+func (m *Mutator) Links(event *types.Event) ([]Link, error) {
+	links := []Link{}
+	linkErrors := LinkErrors{}
+	window := m.window(event)
+	for _, provider := range m.providers {
+		if !provider.Applies(event) {
+			continue
+		}
+		providerLinks, err := provider.Build(event, window)
+		for _, link := range providerLinks {
+			if link.Rule == "" {
+				link.Rule = provider.Name()
+			}
+			m.observeLink(link.Rule, true)
+			links = append(links, link)
+		}
+		if err == nil {
+			continue
+		}
+		providerErrors, ok := err.(LinkErrors)
+		if !ok {
+			providerErrors = LinkErrors{{Name: provider.Name(), Reason: err.Error()}}
+		}
+		for _, linkError := range providerErrors {
+			if linkError.Rule == "" {
+				linkError.Rule = provider.Name()
+			}
+			m.observeLink(linkError.Rule, false)
+			linkErrors = append(linkErrors, linkError)
+		}
+	}
+	if len(linkErrors) != 0 {
+		return links, linkErrors
+	}
+	return links, nil
+}
+
+// observeLink calls LinkObserver if it is used
+func (m *Mutator) observeLink(rule string, created bool) {
+	if m.config.LinkObserver != nil {
+		m.config.LinkObserver(rule, created)
+	}
+}
+
+// window returns the time range used by all links created for an event
+func (m *Mutator) window(event *types.Event) Window {
+	return Window{
+		From: event.Timestamp*1000 - m.config.TimeRange.Milliseconds(),
+		To:   event.Timestamp*1000 + m.config.TimeRange.Milliseconds(),
+	}
+}
+
+// GrafanaInstance returns the grafana instance selected by --grafana-instances for an event
+func (m *Mutator) GrafanaInstance(event *types.Event) GrafanaInstance {
+	return m.selectGrafanaInstance(event)
+}
+
+// Mutate adds all links as event.check.annotations. Link errors are only reported in ErrorsAnnotation and
+// ErrorAnnotation annotations, then all other links are kept. An error is returned only for events that cannot
+// be mutated, unless AlwaysReturnEvent is used.
+func (m *Mutator) Mutate(event *types.Event) (*types.Event, error) {
+	if event == nil || event.Check == nil {
+		if m.config.AlwaysReturnEvent {
+			return event, nil
+		}
+		return event, fmt.Errorf("event without check cannot be mutated")
+	}
+	links, err := m.Links(event)
+	return m.AddLinks(event, links, err), nil
+}
+
+// AddLinks adds links and link errors returned by Links as event.check.annotations, like Mutate.
+// Existing annotations are not changed.
+func (m *Mutator) AddLinks(event *types.Event, links []Link, err error) *types.Event {
+	annotations := make(map[string]string)
+	// if check.annotations is empty, make it
+	if event.Check.Annotations == nil {
+		event.Check.Annotations = make(map[string]string)
+	}
+	for _, link := range links {
+		annotations[link.Name] = link.URL
+	}
+	// report all errors and keep all links created
+	linkErrors, ok := err.(LinkErrors)
+	if err != nil && !ok {
+		linkErrors = LinkErrors{{Name: m.config.Name, Reason: err.Error()}}
+	}
+	if len(linkErrors) != 0 {
+		// LinkErrors has only strings, it cannot fail
+		errorsJSON, _ := json.Marshal(linkErrors)
+		annotations[m.ErrorsAnnotation()] = string(errorsJSON)
+		annotations[m.ErrorAnnotation()] = linkErrors.Error()
+	}
+
+	// merge new annotations into event.check.annotation
+	event.Check.Annotations = mergeStringMaps(event.Check.Annotations, annotations)
+	return event
+}
+
+// generateDashboardURL returns the annotation name and the dashboard URL. autoVariables are dashboard
+// template variables added only if they are found in event labels.
+// An empty URL without error means the event doesn't match this dashboard.
+func generateDashboardURL(event *types.Event, instance GrafanaInstance, v DashboardSuggested, autoVariables []string, templateData TemplateData, fromDate, toDate int64) (string, string, error) {
+	output := dashboardAnnotation(v)
+	grafanaAnnotation, err := renderTemplate(v.GrafanaAnnotation, templateData)
+	if err != nil {
+		return output, "", fmt.Errorf("failed rendering grafana_annotation template %v", err)
+	}
+	output = fmt.Sprintf("grafana_%s_url", strings.ToLower(grafanaAnnotation))
+	dashboardURL, err := renderTemplate(v.DashboardURL, templateData)
+	if err != nil {
+		return output, "", fmt.Errorf("failed rendering dashboard_url template %v", err)
+	}
+	grafanaURL, err := url.Parse(dashboardURL)
+	if err == nil {
+		err = rewriteDashboardURL(grafanaURL, instance)
+	}
+	if err != nil {
+		return output, "", fmt.Errorf("failed generating grafana URL %v", err)
+	}
+	if !checkMissingOrgID(grafanaURL.Query()) {
+		return output, "", fmt.Errorf("Missing orgId in grafana URL in --grafana-dashboard-suggested. e. https://grafana.com/?orgId=1")
+	}
+	timeRange := fmt.Sprintf("&from=%d&to=%d", fromDate, toDate)
+	if v.MatchLabels != nil || len(v.MatchSelectors) != 0 || v.Expression != "" {
+		matched, err := matchDashboardSuggested(event, v)
+		if err != nil {
+			return output, "", fmt.Errorf("failed matching dashboard %v", err)
+		}
+		if !matched {
+			return output, "", nil
+		}
+		if v.Labels == nil {
+			// only match labels is used, no labels provided
+			return output, fmt.Sprintf("%s%s%s%s", grafanaURL, timeRange, generateURIByAutoVariables(event, v, autoVariables), viewPanelURI(event, v)), nil
+		}
+	}
+	// case match matchLabels and found labels
+	finalURI, validFinalURI := generateURIBySliceWithVariables(event, v.Labels, v.Variables)
+	if !validFinalURI {
+		return output, "", nil
+	}
+	return output, fmt.Sprintf("%s%s%s%s%s", grafanaURL, timeRange, finalURI, generateURIByAutoVariables(event, v, autoVariables), viewPanelURI(event, v)), nil
+}
+
+// selectPanel returns the panel id from the first panels entry matching event alertname label or check name,
+// otherwise panel_id. Panel titles should be already resolved. Zero means the whole dashboard.
+func selectPanel(event *types.Event, v DashboardSuggested) int {
+	alertname, _ := extractLabels(event, "alertname")
+	for _, p := range v.Panels {
+		if (p.Alertname != "" && p.Alertname == alertname) || (p.CheckName != "" && event.Check != nil && p.CheckName == event.Check.Name) {
+			return p.PanelID
+		}
+	}
+	return v.PanelID
+}
+
+// viewPanelURI returns &viewPanel=<id> to open only one dashboard panel
+func viewPanelURI(event *types.Event, v DashboardSuggested) string {
+	if panelID := selectPanel(event, v); panelID != 0 {
+		return fmt.Sprintf("&viewPanel=%d", panelID)
+	}
+	return ""
+}
+
+// dashboardAnnotation returns the annotation name before rendering grafana_annotation template
+func dashboardAnnotation(v DashboardSuggested) string {
+	return fmt.Sprintf("grafana_%s_url", strings.ToLower(v.GrafanaAnnotation))
+}
+
+// lokiLinkApplies returns true for sensu-kubernetes-events, sensu-alertmanager-events (if enabled) and other events
+func (m *Mutator) lokiLinkApplies(othersIntegrationsFound string) bool {
+	return othersIntegrationsFound == "none" ||
+		(m.config.KubernetesEventsIntegration && othersIntegrationsFound == m.config.KubernetesIntegrationLabel) ||
+		(m.config.AlertmanagerEventsIntegration && othersIntegrationsFound == m.config.AlertmanagerIntegrationLabel)
+}
+
+// prometheusLinkApplies skips sensu-kubernetes-events because its labels are loki stream labels
+func (m *Mutator) prometheusLinkApplies(othersIntegrationsFound string) bool {
+	return othersIntegrationsFound == "none" ||
+		(m.config.AlertmanagerEventsIntegration && othersIntegrationsFound == m.config.AlertmanagerIntegrationLabel)
+}
+
+func (m *Mutator) generateGrafanaURL(instance GrafanaInstance, l map[string]string, fromDate, toDate int64) (string, error) {
+	query := lokiExploreQuery(l, m.lokiStreamMatchers, instance.LokiDatasource)
+	grafanaURL, err := grafanaExploreLinkURL(instance.GrafanaURL, m.config.GrafanaExploreURLVersion, query, fromDate, toDate)
+	if err != nil {
+		return "", err
+	}
+	return grafanaURL, nil
+}
+
+func (m *Mutator) generateGrafanaPrometheusURL(instance GrafanaInstance, l map[string]string, fromDate, toDate int64) (string, error) {
+	query := prometheusExploreQuery(l, m.config.GrafanaPrometheusMetric, instance.PrometheusDatasource)
+	grafanaURL, err := grafanaExploreLinkURL(instance.GrafanaURL, m.config.GrafanaExploreURLVersion, query, fromDate, toDate)
+	if err != nil {
+		return "", err
+	}
+	return grafanaURL, nil
+}
+
+func (m *Mutator) generateGrafanaTempoURL(instance GrafanaInstance, traceID string, fromDate, toDate int64) (string, error) {
+	query := tempoExploreQuery(traceID, instance.TempoDatasource)
+	grafanaURL, err := grafanaExploreLinkURL(instance.GrafanaURL, m.config.GrafanaExploreURLVersion, query, fromDate, toDate)
+	if err != nil {
+		return "", err
+	}
+	return grafanaURL, nil
+}
+
+func checkMissingOrgID(u url.Values) bool {
+	for k, v := range u {
+		if k == "orgId" && len(v) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func mergeStringMaps(left, right map[string]string) map[string]string {
+	for k, v := range right {
+		// fmt.Println(left[k])
+		if left[k] == "" {
+			left[k] = v
+		}
+	}
+	return left
+}
@@ -0,0 +1,114 @@
+package mutator
+
+import (
+	"net/url"
+	"testing"
+
+	v2 "github.com/sensu/sensu-go/api/core/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	_, err1 := New(DefaultConfig())
+	assert.Error(t, err1)
+	config := DefaultConfig()
+	config.GrafanaURL = "https://grafana.com/?orgId=1"
+	config.GrafanaExploreLinkEnabled = true
+	m, err2 := New(config)
+	assert.NoError(t, err2)
+	assert.Equal(t, "sensu-grafana-mutator/errors", m.ErrorsAnnotation())
+	config.GrafanaExploreURLVersion = "v3"
+	_, err3 := New(config)
+	assert.Error(t, err3)
+}
+
+func TestLinks(t *testing.T) {
+	config := DefaultConfig()
+	config.GrafanaURL = "https://grafana.com/?orgId=1"
+	config.GrafanaExploreLinkEnabled = true
+	config.GrafanaDashboardSuggested = []DashboardSuggested{
+		{GrafanaAnnotation: "nodes", DashboardURL: "https://grafana.com/d/nodes?orgId=1", Labels: []string{"namespace"}},
+		{GrafanaAnnotation: "pods", DashboardURL: "https://grafana.com/d/pods?orgId=1", Labels: []string{"pod"}},
+	}
+	m, err := New(config)
+	assert.NoError(t, err)
+	event := v2.FixtureEvent("entity1", "check1")
+	event.Check.Labels = map[string]string{"namespace": "spacename"}
+	links, err := m.Links(event)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(links))
+	assert.Equal(t, "grafana_loki_url", links[0].Name)
+	assert.Equal(t, "grafana_nodes_url", links[1].Name)
+	assert.Contains(t, links[1].URL, "var-namespace=spacename")
+	assert.Empty(t, event.Check.Annotations)
+}
+
+func TestMutatePartialFailure(t *testing.T) {
+	// not created by New to skip validation of the broken dashboard
+	m := &Mutator{config: DefaultConfig()}
+	m.config.GrafanaURL = "https://grafana.com/?orgId=1"
+	m.config.GrafanaExploreLinkEnabled = true
+	m.config.GrafanaDashboardSuggested = []DashboardSuggested{
+		{GrafanaAnnotation: "broken", DashboardURL: "https://grafana.com/d/broken"},
+		{GrafanaAnnotation: "nodes", DashboardURL: "https://grafana.com/d/nodes?orgId=1", Labels: []string{"namespace"}},
+	}
+	m.config.AlwaysReturnEvent = true
+	m.providers = m.newProviders()
+	event := v2.FixtureEvent("entity1", "check1")
+	event.Check.Labels = map[string]string{"namespace": "spacename"}
+	result, err := m.Mutate(event)
+	assert.NoError(t, err)
+	assert.Contains(t, result.Check.Annotations, "grafana_loki_url")
+	assert.Contains(t, result.Check.Annotations, "grafana_nodes_url")
+	assert.NotContains(t, result.Check.Annotations, "grafana_broken_url")
+	assert.Contains(t, result.Check.Annotations["sensu-grafana-mutator/errors"], `"name":"grafana_broken_url"`)
+	assert.Contains(t, result.Check.Annotations["sensu-grafana-mutator/error"], "grafana_broken_url")
+	event2 := v2.FixtureEvent("entity1", "check1")
+	event2.Check.Labels = map[string]string{"namespace": "spacename"}
+	m.config.AlwaysReturnEvent = false
+	result2, err2 := m.Mutate(event2)
+	assert.NoError(t, err2)
+	assert.Contains(t, result2.Check.Annotations, "grafana_nodes_url")
+	assert.Contains(t, result2.Check.Annotations["sensu-grafana-mutator/errors"], `"name":"grafana_broken_url"`)
+	// only events without check return an error
+	event3 := v2.FixtureEvent("entity1", "check1")
+	event3.Check = nil
+	_, err3 := m.Mutate(event3)
+	assert.Error(t, err3)
+	m.config.AlwaysReturnEvent = true
+	result4, err4 := m.Mutate(event3)
+	assert.NoError(t, err4)
+	assert.Equal(t, event3, result4)
+}
+
+func TestCheckMissingOrgID(t *testing.T) {
+	grafanaURL1, _ := url.Parse("https://grafana.com/?orgId=1")
+	value1 := checkMissingOrgID(grafanaURL1.Query())
+	assert.True(t, value1)
+	grafanaURL2, _ := url.Parse("https://grafana.com/?orgid=1")
+	value2 := checkMissingOrgID(grafanaURL2.Query())
+	assert.False(t, value2)
+}
+
+func TestMergeStringMaps(t *testing.T) {
+	left1 := map[string]string{"left1": "leftValue1"}
+	right1 := map[string]string{"right1": "rightValue1"}
+	val1 := map[string]string{"left1": "leftValue1", "right1": "rightValue1"}
+	res1 := mergeStringMaps(left1, right1)
+	assert.Equal(t, val1, res1)
+	left2 := map[string]string{"left1": "leftValue1"}
+	right2 := map[string]string{"right1": "rightValue1", "left1": "rightValueLeft1"}
+	val2 := map[string]string{"left1": "leftValue1", "right1": "rightValue1"}
+	res2 := mergeStringMaps(left2, right2)
+	assert.Equal(t, val2, res2)
+	left3 := map[string]string{"left1": "leftValue1"}
+	right3 := map[string]string{}
+	val3 := map[string]string{"left1": "leftValue1"}
+	res3 := mergeStringMaps(left3, right3)
+	assert.Equal(t, val3, res3)
+	left4 := map[string]string{}
+	right4 := map[string]string{"right1": "rightValue1"}
+	val4 := map[string]string{"right1": "rightValue1"}
+	res4 := mergeStringMaps(left4, right4)
+	assert.Equal(t, val4, res4)
+}
@@ -0,0 +1,86 @@
+package mutator
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/sensu/sensu-go/types"
+)
+
+const (
+	// dashboardSuggestedAddKey adds dashboards (json list) to --grafana-dashboard-suggested for one check or entity
+	dashboardSuggestedAddKey = "dashboard-suggested-add"
+	// dashboardSuggestedDisableKey disables dashboards by grafana_annotation (comma separated or all) for one check or entity
+	dashboardSuggestedDisableKey = "dashboard-suggested-disable"
+)
+
+// AnnotationOverride returns the value from check or entity annotation keyspace/key,
+// e.g. sensu.io/plugins/sensu-grafana-mutator/config/key. Check annotations have precedence.
+func AnnotationOverride(event *types.Event, keyspace, key string) string {
+	annotation := path.Join(keyspace, key)
+	if event.Check != nil && event.Check.Annotations[annotation] != "" {
+		return event.Check.Annotations[annotation]
+	}
+	if event.Entity != nil && event.Entity.Annotations[annotation] != "" {
+		return event.Entity.Annotations[annotation]
+	}
+	return ""
+}
+
+// annotationOverride returns AnnotationOverride using --keyspace
+func (m *Mutator) annotationOverride(event *types.Event, key string) string {
+	return AnnotationOverride(event, m.config.Keyspace, key)
+}
+
+// dashboardsSuggestedForEvent returns --grafana-dashboard-suggested and --grafana-dashboards-dir with dashboards added
+// and without dashboards disabled by check or entity annotations.
+// Invalid dashboards in annotations are ignored and reported as error.
+func (m *Mutator) dashboardsSuggestedForEvent(event *types.Event) ([]DashboardSuggested, error) {
+	dashboardSuggested := append([]DashboardSuggested{}, m.config.GrafanaDashboardSuggested...)
+	dashboardSuggested = append(dashboardSuggested, m.provisioned...)
+	var extraErr error
+	if extra := m.annotationOverride(event, dashboardSuggestedAddKey); extra != "" {
+		annotation := path.Join(m.config.Keyspace, dashboardSuggestedAddKey)
+		extraDashboards, err := ParseDashboardSuggested(extra)
+		if err == nil {
+			if problems := validateDashboardSuggested(extraDashboards); len(problems) != 0 {
+				err = JoinErrors(problems)
+			}
+		}
+		for _, v := range extraDashboards {
+			// annotations cannot read files from mutator host
+			if err == nil && v.DashboardFile != "" {
+				err = fmt.Errorf("dashboard_file is not allowed in annotations")
+			}
+		}
+		if err != nil {
+			extraErr = fmt.Errorf("annotation %s: %v", annotation, err)
+		} else {
+			dashboardSuggested = append(dashboardSuggested, extraDashboards...)
+		}
+	}
+	disabled := splitList(m.annotationOverride(event, dashboardSuggestedDisableKey))
+	if len(disabled) == 0 {
+		return dashboardSuggested, extraErr
+	}
+	enabled := []DashboardSuggested{}
+	for _, v := range dashboardSuggested {
+		if containsString(disabled, "all") || containsString(disabled, strings.TrimSpace(v.GrafanaAnnotation)) {
+			continue
+		}
+		enabled = append(enabled, v)
+	}
+	return enabled, extraErr
+}
+
+// splitList splits a comma separated list ignoring empty items
+func splitList(s string) []string {
+	list := []string{}
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
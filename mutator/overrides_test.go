@@ -0,0 +1,48 @@
+package mutator
+
+import (
+	"testing"
+
+	v2 "github.com/sensu/sensu-go/api/core/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnnotationOverride(t *testing.T) {
+	m := &Mutator{config: DefaultConfig()}
+	event1 := v2.FixtureEvent("entity1", "check1")
+	event1.Entity.Annotations = map[string]string{"sensu.io/plugins/sensu-grafana-mutator/config/dashboard-suggested-disable": "entity"}
+	assert.Equal(t, "entity", m.annotationOverride(event1, dashboardSuggestedDisableKey))
+	event1.Check.Annotations = map[string]string{"sensu.io/plugins/sensu-grafana-mutator/config/dashboard-suggested-disable": "check"}
+	assert.Equal(t, "check", m.annotationOverride(event1, dashboardSuggestedDisableKey))
+	assert.Equal(t, "", m.annotationOverride(event1, dashboardSuggestedAddKey))
+	assert.Equal(t, "check", AnnotationOverride(event1, "sensu.io/plugins/sensu-grafana-mutator/config", "dashboard-suggested-disable"))
+	assert.Equal(t, "", AnnotationOverride(event1, "sensu.io/plugins/other/config", "dashboard-suggested-disable"))
+}
+
+func TestDashboardsSuggestedForEvent(t *testing.T) {
+	m := &Mutator{config: DefaultConfig()}
+	m.config.GrafanaDashboardSuggested, _ = ParseDashboardSuggested(`[{"grafana_annotation":"kubelet","dashboard_url":"https://grafana.example.com/d/3138fa155d5915769fbded898ac09fd9/kubernetes-kubelet?orgId=1","labels":["cluster"]},{"grafana_annotation":"namespace","dashboard_url":"https://grafana.example.com/d/85a562078cdf77779eaa1add43ccec1e/kubernetes-compute-resources-namespace-pods?orgId=1","labels":["namespace"]}]`)
+	event1 := v2.FixtureEvent("entity1", "check1")
+	dashboards1, err1 := m.dashboardsSuggestedForEvent(event1)
+	assert.NoError(t, err1)
+	assert.Equal(t, 2, len(dashboards1))
+
+	event1.Check.Annotations = map[string]string{
+		"sensu.io/plugins/sensu-grafana-mutator/config/dashboard-suggested-add":     `[{"grafana_annotation":"disk","dashboard_url":"https://grafana.example.com/d/rYdddlPWk/node-exporter-full?orgId=1","labels":["hostname"]}]`,
+		"sensu.io/plugins/sensu-grafana-mutator/config/dashboard-suggested-disable": "kubelet",
+	}
+	dashboards2, err2 := m.dashboardsSuggestedForEvent(event1)
+	assert.NoError(t, err2)
+	assert.Equal(t, 2, len(dashboards2))
+	assert.Equal(t, "namespace", dashboards2[0].GrafanaAnnotation)
+	assert.Equal(t, "disk", dashboards2[1].GrafanaAnnotation)
+
+	event1.Check.Annotations["sensu.io/plugins/sensu-grafana-mutator/config/dashboard-suggested-disable"] = "all"
+	dashboards3, err3 := m.dashboardsSuggestedForEvent(event1)
+	assert.NoError(t, err3)
+	assert.Equal(t, 0, len(dashboards3))
+
+	event1.Check.Annotations["sensu.io/plugins/sensu-grafana-mutator/config/dashboard-suggested-add"] = "["
+	_, err4 := m.dashboardsSuggestedForEvent(event1)
+	assert.Error(t, err4)
+}
@@ -0,0 +1,381 @@
+package mutator
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/sensu/sensu-go/types"
+)
+
+// Window is the time range, in milliseconds, used by all links created for one event
+type Window struct {
+	From int64
+	To   int64
+}
+
+// LinkProvider creates links for one backend. Build is only called when Applies returns true.
+// Build can return some links and a LinkErrors error, other errors are reported using Name.
+type LinkProvider interface {
+	Name() string
+	Applies(event *types.Event) bool
+	Build(event *types.Event, window Window) ([]Link, error)
+}
+
+// Explainer is an optional LinkProvider interface. Explain is always called by Mutator.Explain, it writes
+// why links were created or skipped. Providers without it are explained by ExplainLinks.
+type Explainer interface {
+	Explain(w io.Writer, event *types.Event, window Window)
+}
+
+// ProviderFactory creates a LinkProvider for a Mutator, it can use m.Config() and m.GrafanaInstance(event).
+// Built-in factories return nil when the provider is disabled by its flags.
+type ProviderFactory func(m *Mutator) LinkProvider
+
+type providerEntry struct {
+	name    string
+	factory ProviderFactory
+	builtin bool
+}
+
+var (
+	providersMutex sync.RWMutex
+	// providers keeps registration order, links are created in this order
+	providers = []providerEntry{}
+)
+
+func init() {
+	registerBuiltinProvider("loki", newLokiProvider)
+	registerBuiltinProvider("kubernetes-events", newKubernetesEventsProvider)
+	registerBuiltinProvider("alertmanager-events", newAlertmanagerEventsProvider)
+	registerBuiltinProvider("prometheus", newPrometheusProvider)
+	registerBuiltinProvider("tempo", newTempoProvider)
+	registerBuiltinProvider("explore-split", newExploreSplitProvider)
+	registerBuiltinProvider("dashboards", newDashboardsProvider)
+}
+
+// RegisterProvider adds a new link provider. It is used only by mutators created after it
+// with its name in Config.LinkProviders, it is only available to programs importing this package.
+// It panics if name is already registered.
+func RegisterProvider(name string, factory ProviderFactory) {
+	registerProvider(providerEntry{name: name, factory: factory})
+}
+
+func registerBuiltinProvider(name string, factory ProviderFactory) {
+	registerProvider(providerEntry{name: name, factory: factory, builtin: true})
+}
+
+func registerProvider(entry providerEntry) {
+	providersMutex.Lock()
+	defer providersMutex.Unlock()
+	for _, p := range providers {
+		if p.name == entry.name {
+			panic(fmt.Sprintf("link provider %s already registered", entry.name))
+		}
+	}
+	providers = append(providers, entry)
+}
+
+// Providers returns all registered link providers names
+func Providers() []string {
+	providersMutex.RLock()
+	defer providersMutex.RUnlock()
+	names := []string{}
+	for _, p := range providers {
+		names = append(names, p.name)
+	}
+	return names
+}
+
+// newProviders creates built-in providers enabled by flags and providers enabled in Config.LinkProviders
+func (m *Mutator) newProviders() []LinkProvider {
+	providersMutex.RLock()
+	defer providersMutex.RUnlock()
+	linkProviders := []LinkProvider{}
+	for _, p := range providers {
+		if !p.builtin && !containsString(m.config.LinkProviders, p.name) {
+			continue
+		}
+		if provider := p.factory(m); provider != nil {
+			linkProviders = append(linkProviders, provider)
+		}
+	}
+	return linkProviders
+}
+
+func isBuiltinProvider(name string) bool {
+	providersMutex.RLock()
+	defer providersMutex.RUnlock()
+	for _, p := range providers {
+		if p.name == name {
+			return p.builtin
+		}
+	}
+	return false
+}
+
+// exploreProvider is used by loki, kubernetes-events, alertmanager-events and prometheus providers
+type exploreProvider struct {
+	m           *Mutator
+	name        string
+	annotation  string
+	integration func(integration string) bool
+	// usedFor describes events using this provider, used by Explain
+	usedFor  string
+	generate func(m *Mutator, instance GrafanaInstance, labels map[string]string, fromDate, toDate int64) (string, error)
+}
+
+func (p *exploreProvider) Name() string {
+	return p.name
+}
+
+func (p *exploreProvider) Applies(event *types.Event) bool {
+	_, integration := p.m.extractLokiLabels(event, p.m.labelsToSearch())
+	return p.integration(integration)
+}
+
+func (p *exploreProvider) Build(event *types.Event, window Window) ([]Link, error) {
+	labels, _ := p.m.extractLokiLabels(event, p.m.labelsToSearch())
+	grafanaURL, err := p.generate(p.m, p.m.selectGrafanaInstance(event), labels, window.From, window.To)
+	if err != nil {
+		return nil, LinkErrors{{Name: p.annotation, Reason: fmt.Sprintf("failed generating grafana URL %v", err)}}
+	}
+	return []Link{{Name: p.annotation, URL: grafanaURL}}, nil
+}
+
+func (p *exploreProvider) Explain(w io.Writer, event *types.Event, window Window) {
+	fmt.Fprintf(w, "\n%s (provider %s):\n", p.annotation, p.name)
+	if _, integration := p.m.extractLokiLabels(event, p.m.labelsToSearch()); !p.integration(integration) {
+		fmt.Fprintf(w, "  skipped: integration %s found, this provider is only used for %s\n", integration, p.usedFor)
+		return
+	}
+	explainBuild(w, p, event, window)
+}
+
+// newLokiProvider creates grafana_loki_url for events without integrations, using sensu label defined in --sensu-label-selector
+func newLokiProvider(m *Mutator) LinkProvider {
+	if !m.config.GrafanaExploreLinkEnabled {
+		return nil
+	}
+	return &exploreProvider{m: m, name: "loki", annotation: "grafana_loki_url", integration: func(integration string) bool {
+		return integration == "none"
+	}, usedFor: "events without integrations", generate: (*Mutator).generateGrafanaURL}
+}
+
+// newKubernetesEventsProvider creates grafana_loki_url for sensu-kubernetes-events plugin events
+func newKubernetesEventsProvider(m *Mutator) LinkProvider {
+	if !m.config.GrafanaExploreLinkEnabled || !m.config.KubernetesEventsIntegration {
+		return nil
+	}
+	return &exploreProvider{m: m, name: "kubernetes-events", annotation: "grafana_loki_url", integration: func(integration string) bool {
+		return integration == m.config.KubernetesIntegrationLabel
+	}, usedFor: m.config.KubernetesIntegrationLabel + " events", generate: (*Mutator).generateGrafanaURL}
+}
+
+// newAlertmanagerEventsProvider creates grafana_loki_url for sensu-alertmanager-events plugin events
+func newAlertmanagerEventsProvider(m *Mutator) LinkProvider {
+	if !m.config.GrafanaExploreLinkEnabled || !m.config.AlertmanagerEventsIntegration {
+		return nil
+	}
+	return &exploreProvider{m: m, name: "alertmanager-events", annotation: "grafana_loki_url", integration: func(integration string) bool {
+		return integration == m.config.AlertmanagerIntegrationLabel
+	}, usedFor: m.config.AlertmanagerIntegrationLabel + " events", generate: (*Mutator).generateGrafanaURL}
+}
+
+// newPrometheusProvider creates grafana_prometheus_url, skipping sensu-kubernetes-events because its labels are loki stream labels
+func newPrometheusProvider(m *Mutator) LinkProvider {
+	if !m.config.GrafanaPrometheusLinkEnabled {
+		return nil
+	}
+	return &exploreProvider{m: m, name: "prometheus", annotation: "grafana_prometheus_url", integration: m.prometheusLinkApplies, usedFor: "integrations enabled with prometheus labels", generate: (*Mutator).generateGrafanaPrometheusURL}
+}
+
+type tempoProvider struct {
+	m *Mutator
+}
+
+// newTempoProvider creates grafana_tempo_url when a trace id is found in labels or check output
+func newTempoProvider(m *Mutator) LinkProvider {
+	if !m.config.GrafanaTempoLinkEnabled {
+		return nil
+	}
+	return &tempoProvider{m: m}
+}
+
+func (p *tempoProvider) Name() string {
+	return "tempo"
+}
+
+func (p *tempoProvider) Applies(event *types.Event) bool {
+	_, found := extractTraceID(event, p.m.config.TempoTraceIDLabel, p.m.traceIDRegexp)
+	return found
+}
+
+func (p *tempoProvider) Build(event *types.Event, window Window) ([]Link, error) {
+	traceID, _ := extractTraceID(event, p.m.config.TempoTraceIDLabel, p.m.traceIDRegexp)
+	grafanaURL, err := p.m.generateGrafanaTempoURL(p.m.selectGrafanaInstance(event), traceID, window.From, window.To)
+	if err != nil {
+		return nil, LinkErrors{{Name: "grafana_tempo_url", Reason: fmt.Sprintf("failed generating grafana URL %v", err)}}
+	}
+	return []Link{{Name: "grafana_tempo_url", URL: grafanaURL}}, nil
+}
+
+func (p *tempoProvider) Explain(w io.Writer, event *types.Event, window Window) {
+	fmt.Fprintf(w, "\ngrafana_tempo_url:\n")
+	fmt.Fprintf(w, "  label %s: %s\n", p.m.config.TempoTraceIDLabel, labelSources(event, p.m.config.TempoTraceIDLabel))
+	traceID, found := extractTraceID(event, p.m.config.TempoTraceIDLabel, p.m.traceIDRegexp)
+	if !found {
+		fmt.Fprintf(w, "  skipped: no valid trace id in label %s or in check output using --tempo-trace-id-regex\n", p.m.config.TempoTraceIDLabel)
+		return
+	}
+	fmt.Fprintf(w, "  trace id: %s\n", traceID)
+	explainBuild(w, p, event, window)
+}
+
+type exploreSplitProvider struct {
+	m *Mutator
+}
+
+// newExploreSplitProvider creates grafana_explore_split_url when both panes have a query
+func newExploreSplitProvider(m *Mutator) LinkProvider {
+	if !m.config.GrafanaExploreSplitEnabled {
+		return nil
+	}
+	return &exploreSplitProvider{m: m}
+}
+
+func (p *exploreSplitProvider) Name() string {
+	return "explore-split"
+}
+
+func (p *exploreSplitProvider) queries(event *types.Event) ([]ExploreQuery, GrafanaInstance) {
+	instance := p.m.selectGrafanaInstance(event)
+	labels, integration := p.m.extractLokiLabels(event, p.m.labelsToSearch())
+	return p.m.splitExploreQueries(event, instance, labels, integration), instance
+}
+
+func (p *exploreSplitProvider) Applies(event *types.Event) bool {
+	queries, _ := p.queries(event)
+	return len(queries) == 2
+}
+
+func (p *exploreSplitProvider) Build(event *types.Event, window Window) ([]Link, error) {
+	queries, instance := p.queries(event)
+	grafanaURL, err := grafanaExploreSplitURL(instance.GrafanaURL, p.m.config.GrafanaExploreURLVersion, queries[0], queries[1], window.From, window.To)
+	if err != nil {
+		return nil, LinkErrors{{Name: "grafana_explore_split_url", Reason: fmt.Sprintf("failed generating grafana URL %v", err)}}
+	}
+	return []Link{{Name: "grafana_explore_split_url", URL: grafanaURL}}, nil
+}
+
+func (p *exploreSplitProvider) Explain(w io.Writer, event *types.Event, window Window) {
+	fmt.Fprintf(w, "\ngrafana_explore_split_url:\n")
+	queries, _ := p.queries(event)
+	for _, q := range queries {
+		fmt.Fprintf(w, "  pane %s: %s\n", q.Datasource, q.Query)
+	}
+	if len(queries) != 2 {
+		fmt.Fprintf(w, "  skipped: only %d of 2 panes (%s) have a query for this event\n", len(queries), strings.Join(p.m.config.GrafanaExploreSplitPanes, ","))
+		return
+	}
+	explainBuild(w, p, event, window)
+}
+
+type dashboardsProvider struct {
+	m *Mutator
+}
+
+// newDashboardsProvider creates one link for each dashboard in --grafana-dashboard-suggested, --grafana-dashboards-dir or in check and entity annotations
+// and, using --grafana-render-images, one image link for each dashboard with a panel
+func newDashboardsProvider(m *Mutator) LinkProvider {
+	return &dashboardsProvider{m: m}
+}
+
+func (p *dashboardsProvider) Name() string {
+	return "dashboards"
+}
+
+func (p *dashboardsProvider) Applies(event *types.Event) bool {
+	return len(p.m.config.GrafanaDashboardSuggested) != 0 || len(p.m.provisioned) != 0 || p.m.annotationOverride(event, dashboardSuggestedAddKey) != ""
+}
+
+// dashboardResult is one dashboard after resolving it and generating its links
+type dashboardResult struct {
+	v             DashboardSuggested
+	resolved      bool
+	autoVariables []string
+	output        string
+	url           string
+	// err is a resolve or generate error, the dashboard has no links
+	err        error
+	links      []Link
+	linkErrors LinkErrors
+}
+
+// buildDashboard resolves one dashboard and creates its link and, using --grafana-render-images, its image link
+func (p *dashboardsProvider) buildDashboard(event *types.Event, instance GrafanaInstance, v DashboardSuggested, templateData TemplateData, window Window) dashboardResult {
+	v, autoVariables, err := p.m.resolver.resolve(v, instance.GrafanaURL)
+	if err != nil {
+		return dashboardResult{v: v, output: dashboardAnnotation(v), err: err}
+	}
+	output, grafanaURL, err := generateDashboardURL(event, instance, v, autoVariables, templateData, window.From, window.To)
+	result := dashboardResult{v: v, resolved: true, autoVariables: autoVariables, output: output, url: grafanaURL, err: err}
+	if err != nil || grafanaURL == "" {
+		return result
+	}
+	rule := dashboardAnnotation(v)
+	result.links = append(result.links, Link{Name: output, URL: grafanaURL, Rule: rule})
+	imageURL, err := p.m.dashboardImageURL(event, v, grafanaURL)
+	if err != nil {
+		result.linkErrors = append(result.linkErrors, LinkError{Name: imageAnnotation(output), Reason: err.Error(), Rule: imageAnnotation(rule)})
+	} else if imageURL != "" {
+		result.links = append(result.links, Link{Name: imageAnnotation(output), URL: imageURL, Rule: imageAnnotation(rule)})
+	}
+	return result
+}
+
+func (p *dashboardsProvider) Build(event *types.Event, window Window) ([]Link, error) {
+	links := []Link{}
+	linkErrors := LinkErrors{}
+	dashboardSuggested, err := p.m.dashboardsSuggestedForEvent(event)
+	if err != nil {
+		linkErrors = append(linkErrors, LinkError{Name: dashboardSuggestedAddKey, Reason: err.Error()})
+	}
+	instance := p.m.selectGrafanaInstance(event)
+	templateData := newTemplateData(event, window.From, window.To)
+	templateData.GrafanaURL = instance.GrafanaURL
+	for _, v := range dashboardSuggested {
+		result := p.buildDashboard(event, instance, v, templateData, window)
+		if result.err != nil {
+			linkErrors = append(linkErrors, LinkError{Name: result.output, Reason: result.err.Error(), Rule: dashboardAnnotation(result.v)})
+			continue
+		}
+		if p.m.config.RuleObserver != nil {
+			p.m.config.RuleObserver(dashboardAnnotation(result.v), result.url != "")
+		}
+		links = append(links, result.links...)
+		linkErrors = append(linkErrors, result.linkErrors...)
+	}
+	if len(linkErrors) != 0 {
+		return links, linkErrors
+	}
+	return links, nil
+}
+
+func (p *dashboardsProvider) Explain(w io.Writer, event *types.Event, window Window) {
+	if disabled := p.m.annotationOverride(event, dashboardSuggestedDisableKey); disabled != "" {
+		fmt.Fprintf(w, "\ndashboards disabled by annotation %s: %s\n", path.Join(p.m.config.Keyspace, dashboardSuggestedDisableKey), disabled)
+	}
+	dashboardSuggested, err := p.m.dashboardsSuggestedForEvent(event)
+	if err != nil {
+		fmt.Fprintf(w, "\n%s:\n  error: %v\n", dashboardSuggestedAddKey, err)
+	}
+	instance := p.m.selectGrafanaInstance(event)
+	templateData := newTemplateData(event, window.From, window.To)
+	templateData.GrafanaURL = instance.GrafanaURL
+	for _, v := range dashboardSuggested {
+		explainDashboard(w, event, p.buildDashboard(event, instance, v, templateData, window))
+	}
+}
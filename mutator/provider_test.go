@@ -0,0 +1,116 @@
+package mutator
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	v2 "github.com/sensu/sensu-go/api/core/v2"
+	"github.com/sensu/sensu-go/types"
+	"github.com/stretchr/testify/assert"
+)
+
+type runbookProvider struct{}
+
+func (p runbookProvider) Name() string {
+	return "test-runbook"
+}
+
+func (p runbookProvider) Applies(event *types.Event) bool {
+	return event.Check.Labels["runbook"] != ""
+}
+
+func (p runbookProvider) Build(event *types.Event, window Window) ([]Link, error) {
+	if event.Check.Labels["runbook"] == "broken" {
+		return nil, errors.New("runbook not found")
+	}
+	return []Link{{Name: "runbook_url", URL: fmt.Sprintf("https://runbooks.example.com/%s?from=%d", event.Check.Labels["runbook"], window.From)}}, nil
+}
+
+func init() {
+	RegisterProvider("test-runbook", func(m *Mutator) LinkProvider {
+		return runbookProvider{}
+	})
+}
+
+func TestRegisterProvider(t *testing.T) {
+	assert.Equal(t, []string{"loki", "kubernetes-events", "alertmanager-events", "prometheus", "tempo", "explore-split", "dashboards", "test-runbook"}, Providers())
+	assert.Panics(t, func() {
+		RegisterProvider("loki", func(m *Mutator) LinkProvider { return nil })
+	})
+}
+
+func TestLinkProviders(t *testing.T) {
+	config := DefaultConfig()
+	config.TimeRange = 0
+	config.LinkProviders = []string{"test-runbook"}
+	m, err := New(config)
+	assert.NoError(t, err)
+	event := v2.FixtureEvent("entity1", "check1")
+	event.Timestamp = 1606487400
+	links1, err1 := m.Links(event)
+	assert.NoError(t, err1)
+	assert.Empty(t, links1)
+
+	event.Check.Labels = map[string]string{"runbook": "disk-full"}
+	links2, err2 := m.Links(event)
+	assert.NoError(t, err2)
+	assert.Equal(t, []Link{{Name: "runbook_url", URL: "https://runbooks.example.com/disk-full?from=1606487400000", Rule: "test-runbook"}}, links2)
+
+	event.Check.Labels["runbook"] = "broken"
+	_, err3 := m.Links(event)
+	assert.Equal(t, LinkErrors{{Name: "test-runbook", Reason: "runbook not found", Rule: "test-runbook"}}, err3)
+
+	var buf bytes.Buffer
+	m.Explain(&buf, event)
+	assert.Contains(t, buf.String(), "provider test-runbook:\n  error: runbook not found")
+
+	// providers are only used if enabled
+	config.LinkProviders = nil
+	config.GrafanaURL = "https://grafana.com/?orgId=1"
+	config.GrafanaExploreLinkEnabled = true
+	m2, err := New(config)
+	assert.NoError(t, err)
+	event.Check.Labels = map[string]string{"runbook": "disk-full", "namespace": "spacename"}
+	links4, err4 := m2.Links(event)
+	assert.NoError(t, err4)
+	assert.Equal(t, 1, len(links4))
+	assert.Equal(t, "grafana_loki_url", links4[0].Name)
+}
+
+func TestValidateLinkProviders(t *testing.T) {
+	config := DefaultConfig()
+	config.LinkProviders = []string{"elasticsearch", "loki"}
+	problems := config.Validate()
+	assert.Equal(t, 2, len(problems))
+	assert.Contains(t, problems[0].Error(), "invalid link provider elasticsearch in LinkProviders")
+	assert.Contains(t, problems[1].Error(), "built-in providers are enabled by their own flags")
+}
+
+func TestLinkObserver(t *testing.T) {
+	config := DefaultConfig()
+	config.LinkProviders = []string{"test-runbook"}
+	config.GrafanaDashboardSuggested = []DashboardSuggested{
+		{GrafanaAnnotation: "{{ .CheckName }}", DashboardURL: "https://grafana.com/d/checks?orgId=1&var-check={{ .CheckName }}"},
+		{GrafanaAnnotation: "nodes", DashboardURL: "https://grafana.com/d/nodes?orgId=1", Labels: []string{"node"}},
+	}
+	rules := []string{}
+	config.RuleObserver = func(rule string, matched bool) {
+		rules = append(rules, fmt.Sprintf("%s %v", rule, matched))
+	}
+	links := []string{}
+	config.LinkObserver = func(rule string, created bool) {
+		links = append(links, fmt.Sprintf("%s %v", rule, created))
+	}
+	m, err := New(config)
+	assert.NoError(t, err)
+	event := v2.FixtureEvent("entity1", "check-disk")
+	event.Check.Labels = map[string]string{"runbook": "broken"}
+	linksCreated, _ := m.Links(event)
+	assert.Equal(t, "grafana_check-disk_url", linksCreated[0].Name)
+
+	// rendered annotation names are not used, they can have any value
+	assert.Equal(t, []string{"grafana_{{ .checkname }}_url true", "grafana_nodes_url false"}, rules)
+	assert.Equal(t, []string{"grafana_{{ .checkname }}_url true", "test-runbook false"}, links)
+}
@@ -0,0 +1,102 @@
+package mutator
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultDashboardsTag is the tag used to choose dashboards in --grafana-dashboards-dir
+const DefaultDashboardsTag = "sensu-link"
+
+// indexDashboardsDir reads all dashboard JSON files in dir and its sub directories, like grafana file provisioning,
+// and returns one dashboard suggested for each dashboard tagged with tag (or all dashboards if tag is empty).
+// Dashboard template variables are the labels required to create its link, dashboards without variables are ignored.
+func indexDashboardsDir(dir, tag string) ([]DashboardSuggested, []error) {
+	dashboards := []DashboardSuggested{}
+	problems := []error{}
+	uids := make(map[string]string)
+	names := make(map[string]string)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || strings.ToLower(filepath.Ext(path)) != ".json" {
+			return nil
+		}
+		model, err := readDashboardModel(path)
+		if err != nil {
+			problems = append(problems, err)
+			return nil
+		}
+		if tag != "" && !containsString(model.Tags, tag) {
+			return nil
+		}
+		if model.UID == "" {
+			problems = append(problems, fmt.Errorf("dashboard file %s has no uid", path))
+			return nil
+		}
+		if first, ok := uids[model.UID]; ok {
+			problems = append(problems, fmt.Errorf("dashboard file %s: uid %s already used by %s", path, model.UID, first))
+			return nil
+		}
+		uids[model.UID] = path
+		labels := provisionedLabels(model)
+		if len(labels) == 0 {
+			return nil
+		}
+		name := provisionedAnnotation(model)
+		if first, ok := names[name]; ok {
+			problems = append(problems, fmt.Errorf("dashboard file %s: grafana_annotation %s already used by %s, change dashboard title", path, name, first))
+			return nil
+		}
+		names[name] = path
+		dashboards = append(dashboards, DashboardSuggested{GrafanaAnnotation: name, DashboardFile: path, Labels: labels})
+		return nil
+	})
+	if err != nil {
+		problems = append(problems, fmt.Errorf("failed reading dashboards directory %v", err))
+	}
+	return dashboards, problems
+}
+
+// provisionedLabels returns dashboard template variables that can be filled by event labels,
+// datasource and interval variables keep dashboard default values
+func provisionedLabels(model dashboardModel) []string {
+	labels := []string{}
+	for _, v := range model.Templating.List {
+		if v.Type == "datasource" || v.Type == "interval" {
+			continue
+		}
+		if containsString(model.variables(), v.Name) && !containsString(labels, v.Name) {
+			labels = append(labels, v.Name)
+		}
+	}
+	return labels
+}
+
+// provisionedAnnotation uses dashboard title as grafana_annotation. e. Kubernetes / Pods becomes kubernetes_pods
+func provisionedAnnotation(model dashboardModel) string {
+	name := strings.ReplaceAll(slugify(model.Title), "-", "_")
+	if name == "" {
+		return strings.ToLower(model.UID)
+	}
+	return name
+}
+
+// withoutConfigured removes provisioned dashboards using a grafana_annotation from --grafana-dashboard-suggested,
+// then a dashboard can be changed adding it to --grafana-dashboard-suggested
+func withoutConfigured(provisioned, configured []DashboardSuggested) []DashboardSuggested {
+	names := []string{}
+	for _, v := range configured {
+		names = append(names, strings.ToLower(strings.TrimSpace(v.GrafanaAnnotation)))
+	}
+	dashboards := []DashboardSuggested{}
+	for _, v := range provisioned {
+		if !containsString(names, v.GrafanaAnnotation) {
+			dashboards = append(dashboards, v)
+		}
+	}
+	return dashboards
+}
@@ -0,0 +1,111 @@
+package mutator
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	v2 "github.com/sensu/sensu-go/api/core/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// writeDashboardsDir writes provisioned dashboards like a git repository with folders
+func writeDashboardsDir(t *testing.T) string {
+	dir := t.TempDir()
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "kubernetes"), 0700))
+	files := map[string]string{
+		"kubernetes/pods.json":  `{"uid":"pods","title":"Kubernetes / Pods","tags":["kubernetes","sensu-link"],"templating":{"list":[{"name":"datasource","type":"datasource"},{"name":"namespace","type":"query"},{"name":"pod","type":"query"},{"name":"filters","type":"adhoc"}]}}`,
+		"kubernetes/nodes.json": `{"uid":"nodes","title":"Kubernetes / Nodes","tags":["kubernetes"],"templating":{"list":[{"name":"node","type":"query"}]}}`,
+		"overview.json":         `{"uid":"overview","title":"Overview","tags":["sensu-link"],"templating":{"list":[{"name":"interval","type":"interval"}]}}`,
+		"provisioning.yaml":     `apiVersion: 1`,
+	}
+	for name, content := range files {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600))
+	}
+	return dir
+}
+
+func TestIndexDashboardsDir(t *testing.T) {
+	dir := writeDashboardsDir(t)
+	dashboards, problems := indexDashboardsDir(dir, DefaultDashboardsTag)
+	assert.Empty(t, problems)
+	assert.Equal(t, []DashboardSuggested{
+		{GrafanaAnnotation: "kubernetes_pods", DashboardFile: filepath.Join(dir, "kubernetes/pods.json"), Labels: []string{"namespace", "pod"}},
+	}, dashboards)
+
+	// empty tag uses all dashboards
+	all, problems2 := indexDashboardsDir(dir, "")
+	assert.Empty(t, problems2)
+	assert.Equal(t, 2, len(all))
+	assert.Equal(t, "kubernetes_nodes", all[0].GrafanaAnnotation)
+
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "zz-copy.json"), []byte(`{"uid":"pods","title":"Pods copy","tags":["sensu-link"]}`), 0600))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "no-uid.json"), []byte(`{"title":"No uid","tags":["sensu-link"]}`), 0600))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "pods.json"), []byte(`{"uid":"pods2","title":"Kubernetes - Pods","tags":["sensu-link"],"templating":{"list":[{"name":"pod","type":"query"}]}}`), 0600))
+	_, problems3 := indexDashboardsDir(dir, DefaultDashboardsTag)
+	assert.Equal(t, 3, len(problems3))
+	assert.Contains(t, problems3[0].Error(), "has no uid")
+	assert.Contains(t, problems3[1].Error(), "grafana_annotation kubernetes_pods already used by")
+	assert.Contains(t, problems3[2].Error(), "uid pods already used by")
+}
+
+func TestLinksDashboardsDir(t *testing.T) {
+	config := DefaultConfig()
+	config.GrafanaURL = "https://grafana.com/grafana/?orgId=1"
+	config.GrafanaDashboardsDir = writeDashboardsDir(t)
+	config.TimeRange = 0
+	m, err := New(config)
+	assert.NoError(t, err)
+	event := v2.FixtureEvent("entity1", "check1")
+	event.Timestamp = 1606487400
+	event.Check.Labels = map[string]string{"namespace": "default"}
+	links1, err1 := m.Links(event)
+	assert.NoError(t, err1)
+	assert.Empty(t, links1)
+
+	event.Check.Labels["pod"] = "nginx-1"
+	links2, err2 := m.Links(event)
+	assert.NoError(t, err2)
+	assert.Equal(t, []Link{{Name: "grafana_kubernetes_pods_url", URL: "https://grafana.com/grafana/d/pods/kubernetes-pods?orgId=1&from=1606487400000&to=1606487400000&var-namespace=default&var-pod=nginx-1", Rule: "grafana_kubernetes_pods_url"}}, links2)
+
+	// dashboards suggested have precedence over provisioned dashboards with the same grafana_annotation
+	config.GrafanaDashboardSuggested = []DashboardSuggested{{GrafanaAnnotation: "kubernetes_pods", DashboardURL: "https://grafana.com/d/other/other?orgId=1", Labels: []string{"pod"}}}
+	m2, err := New(config)
+	assert.NoError(t, err)
+	links3, err3 := m2.Links(event)
+	assert.NoError(t, err3)
+	assert.Equal(t, []Link{{Name: "grafana_kubernetes_pods_url", URL: "https://grafana.com/d/other/other?orgId=1&from=1606487400000&to=1606487400000&var-pod=nginx-1", Rule: "grafana_kubernetes_pods_url"}}, links3)
+
+	// WithConfig reuses dashboards already indexed, even after the directory is changed
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(config.GrafanaDashboardsDir, "broken.json"), []byte(`{`), 0600))
+	config.GrafanaDashboardSuggested = nil
+	m3, err := m.WithConfig(config)
+	assert.NoError(t, err)
+	links4, err4 := m3.Links(event)
+	assert.NoError(t, err4)
+	assert.Equal(t, links2, links4)
+
+	// New returns problems found indexing the directory
+	_, err = New(config)
+	problems, ok := err.(Problems)
+	assert.True(t, ok)
+	assert.Equal(t, 1, len(problems))
+	assert.Contains(t, problems[0].Error(), "grafana-dashboards-dir: failed parsing dashboard file")
+}
+
+func TestValidateDashboardsDir(t *testing.T) {
+	config := DefaultConfig()
+	config.GrafanaDashboardsDir = filepath.Join(t.TempDir(), "missing")
+	problems := config.Validate()
+	assert.Equal(t, 2, len(problems))
+	assert.Contains(t, problems[0].Error(), "using --grafana-dashboards-dir then --grafana-url")
+	assert.Contains(t, problems[1].Error(), "invalid --grafana-dashboards-dir")
+
+	config.GrafanaURL = "https://grafana.com/?orgId=1"
+	config.GrafanaDashboardsDir = writeDashboardsDir(t)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(config.GrafanaDashboardsDir, "broken.json"), []byte(`{`), 0600))
+	problems2 := config.Validate()
+	assert.Equal(t, 1, len(problems2))
+	assert.Contains(t, problems2[0].Error(), "grafana-dashboards-dir: failed parsing dashboard file")
+}
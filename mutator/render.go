@@ -0,0 +1,44 @@
+package mutator
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/sensu/sensu-go/types"
+)
+
+// imageAnnotation returns grafana_<name>_image_url from grafana_<name>_url
+func imageAnnotation(output string) string {
+	return fmt.Sprintf("%s_image_url", strings.TrimSuffix(output, "_url"))
+}
+
+// dashboardImageURL returns a grafana image renderer URL for the panel chosen for this event, using the same
+// dashboard URL, variables and time range. It returns empty if --grafana-render-images is disabled or no panel was chosen.
+func (m *Mutator) dashboardImageURL(event *types.Event, v DashboardSuggested, dashboardURL string) (string, error) {
+	panelID := selectPanel(event, v)
+	if !m.config.GrafanaRenderImages || panelID == 0 || dashboardURL == "" {
+		return "", nil
+	}
+	return renderImageURL(dashboardURL, panelID, m.config)
+}
+
+// renderImageURL changes /d/<uid>/<slug>?...&viewPanel=<id> to /render/d-solo/<uid>/<slug>?...&panelId=<id>
+// keeping all other parameters as they are
+func renderImageURL(dashboardURL string, panelID int, config Config) (string, error) {
+	u, err := url.Parse(dashboardURL)
+	if err != nil {
+		return "", err
+	}
+	i := strings.Index(u.Path, "/d/")
+	if i == -1 {
+		return "", fmt.Errorf("dashboard_url should be like https://grafana.com/d/<uid> to render panel images")
+	}
+	query := strings.TrimSuffix(u.RawQuery, fmt.Sprintf("&viewPanel=%d", panelID))
+	imageURL := fmt.Sprintf("%s://%s%s/render/d-solo/%s?%s&panelId=%d&width=%d&height=%d&theme=%s",
+		u.Scheme, u.Host, u.Path[:i], u.Path[i+len("/d/"):], query, panelID, config.GrafanaRenderWidth, config.GrafanaRenderHeight, url.QueryEscape(config.GrafanaRenderTheme))
+	if config.GrafanaRenderTimezone != "" {
+		imageURL += fmt.Sprintf("&tz=%s", url.QueryEscape(config.GrafanaRenderTimezone))
+	}
+	return imageURL, nil
+}
@@ -0,0 +1,66 @@
+package mutator
+
+import (
+	"bytes"
+	"testing"
+
+	v2 "github.com/sensu/sensu-go/api/core/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderImageURL(t *testing.T) {
+	config := DefaultConfig()
+	config.GrafanaRenderTimezone = "Europe/Berlin"
+	imageURL, err := renderImageURL("https://grafana.com/grafana/d/nodes/kubernetes-nodes?orgId=1&from=1&to=2&var-node=node1&viewPanel=12", 12, config)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://grafana.com/grafana/render/d-solo/nodes/kubernetes-nodes?orgId=1&from=1&to=2&var-node=node1&panelId=12&width=1000&height=500&theme=light&tz=Europe%2FBerlin", imageURL)
+
+	config.GrafanaRenderTimezone = ""
+	config.GrafanaRenderTheme = "dark"
+	imageURL2, err := renderImageURL("https://grafana.com/d/nodes?orgId=1&viewPanel=2", 2, config)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://grafana.com/render/d-solo/nodes?orgId=1&panelId=2&width=1000&height=500&theme=dark", imageURL2)
+
+	_, err = renderImageURL("https://grafana.com/dashboards/nodes?orgId=1", 2, config)
+	assert.Error(t, err)
+}
+
+func TestLinksRenderImages(t *testing.T) {
+	config := DefaultConfig()
+	config.TimeRange = 0
+	config.GrafanaRenderImages = true
+	config.GrafanaDashboardSuggested = []DashboardSuggested{
+		{GrafanaAnnotation: "nodes", DashboardURL: "https://grafana.com/d/nodes/nodes?orgId=1", Labels: []string{"node"}, Panels: []DashboardPanel{{CheckName: "check-cpu", PanelID: 3}}},
+		{GrafanaAnnotation: "pods", DashboardURL: "https://grafana.com/pods?orgId=1", Labels: []string{"node"}, PanelID: 4},
+	}
+	m, err := New(config)
+	assert.NoError(t, err)
+	event := v2.FixtureEvent("entity1", "check1")
+	event.Timestamp = 1606487400
+	event.Check.Labels = map[string]string{"node": "node1"}
+	links1, err1 := m.Links(event)
+	assert.Equal(t, LinkErrors{{Name: "grafana_pods_image_url", Reason: "dashboard_url should be like https://grafana.com/d/<uid> to render panel images", Rule: "grafana_pods_image_url"}}, err1)
+	assert.Equal(t, 2, len(links1))
+
+	// nodes dashboard has a panel only for check-cpu
+	event.Check.Name = "check-cpu"
+	links2, _ := m.Links(event)
+	assert.Equal(t, 3, len(links2))
+	assert.Equal(t, Link{Name: "grafana_nodes_image_url", URL: "https://grafana.com/render/d-solo/nodes/nodes?orgId=1&from=1606487400000&to=1606487400000&var-node=node1&panelId=3&width=1000&height=500&theme=light&tz=UTC", Rule: "grafana_nodes_image_url"}, links2[1])
+
+	var buf bytes.Buffer
+	m.Explain(&buf, event)
+	assert.Contains(t, buf.String(), "  image url: https://grafana.com/render/d-solo/nodes/nodes?")
+}
+
+func TestValidateRenderImages(t *testing.T) {
+	config := DefaultConfig()
+	config.GrafanaDashboardSuggested = []DashboardSuggested{{GrafanaAnnotation: "nodes", DashboardURL: "https://grafana.com/d/nodes?orgId=1", PanelID: 2}}
+	config.GrafanaRenderImages = true
+	config.GrafanaRenderWidth = 0
+	config.GrafanaRenderTheme = "blue"
+	problems := config.Validate()
+	assert.Equal(t, 2, len(problems))
+	assert.Contains(t, problems[0].Error(), "invalid --grafana-render-width 0")
+	assert.Contains(t, problems[1].Error(), "invalid --grafana-render-theme blue")
+}
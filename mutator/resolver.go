@@ -0,0 +1,539 @@
+package mutator
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// grafanaAPITimeout is used in all requests to grafana HTTP API
+	grafanaAPITimeout = 5 * time.Second
+	// grafanaAPIBackoff is the time an expired dashboard is used, without calling grafana API, after a failed request
+	grafanaAPIBackoff = time.Minute
+)
+
+// dashboardResolver finds dashboard URLs, template variables and panels by uid, title or tag using grafana HTTP API
+// of the grafana instance selected for each event or in dashboard files. API results are cached in memory and,
+// if cacheFile is used, on disk until ttl expires.
+type dashboardResolver struct {
+	token     string
+	tokenURLs []string
+	cacheFile string
+	ttl       time.Duration
+	client    *http.Client
+
+	mutex       sync.Mutex
+	cache       map[string]resolverCacheEntry
+	cacheLoaded bool
+	calls       map[string]*resolverCall
+	files       map[string]dashboardFileEntry
+}
+
+// resolverCacheEntry is one dashboard in cache file, the key is the grafana URL and orgId followed by
+// uid:<uid>, title:<title> or tag:<tag>
+type resolverCacheEntry struct {
+	URL       string         `json:"url"`
+	Variables []string       `json:"variables,omitempty"`
+	Panels    map[string]int `json:"panels,omitempty"`
+	Expires   time.Time      `json:"expires"`
+}
+
+// resolverCall is a grafana API request in progress, lookups for the same key wait for it instead of calling grafana again
+type resolverCall struct {
+	done  chan struct{}
+	entry resolverCacheEntry
+	err   error
+}
+
+// grafanaSearchResult is one item returned by /api/search
+type grafanaSearchResult struct {
+	UID   string   `json:"uid"`
+	Title string   `json:"title"`
+	URL   string   `json:"url"`
+	Tags  []string `json:"tags"`
+}
+
+// dashboardModel is the part of grafana dashboard JSON model used by the mutator
+type dashboardModel struct {
+	UID        string   `json:"uid"`
+	Title      string   `json:"title"`
+	Tags       []string `json:"tags"`
+	Templating struct {
+		List []dashboardVariable `json:"list"`
+	} `json:"templating"`
+	Panels []dashboardPanel `json:"panels"`
+}
+
+// dashboardPanel is one item in dashboard panels, rows keep their panels when collapsed
+type dashboardPanel struct {
+	ID     int              `json:"id"`
+	Title  string           `json:"title"`
+	Panels []dashboardPanel `json:"panels"`
+}
+
+// dashboardVariable is one item in dashboard templating.list
+type dashboardVariable struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// variables returns template variables names that can be used as &var-name=value
+func (d dashboardModel) variables() []string {
+	variables := []string{}
+	for _, v := range d.Templating.List {
+		// adhoc filters don't use var-name=value and constants cannot be changed
+		if v.Name == "" || v.Type == "adhoc" || v.Type == "constant" {
+			continue
+		}
+		variables = append(variables, v.Name)
+	}
+	return variables
+}
+
+// panelIDs returns all panels ids by title, including panels inside rows. The first panel is used for duplicated titles
+func (d dashboardModel) panelIDs() map[string]int {
+	ids := make(map[string]int)
+	var add func(panels []dashboardPanel)
+	add = func(panels []dashboardPanel) {
+		for _, p := range panels {
+			if _, ok := ids[p.Title]; !ok && p.Title != "" {
+				ids[p.Title] = p.ID
+			}
+			add(p.Panels)
+		}
+	}
+	add(d.Panels)
+	return ids
+}
+
+// dashboardFileEntry keeps a dashboard file parsed until it is changed
+type dashboardFileEntry struct {
+	modTime time.Time
+	model   dashboardModel
+}
+
+func newDashboardResolver(config Config) *dashboardResolver {
+	return &dashboardResolver{
+		token:     config.GrafanaAPIToken,
+		tokenURLs: grafanaAPIBases(config.grafanaAPIURLs()),
+		cacheFile: config.GrafanaAPICacheFile,
+		ttl:       config.GrafanaAPICacheTTL,
+		client:    &http.Client{Timeout: grafanaAPITimeout},
+		cache:     make(map[string]resolverCacheEntry),
+		calls:     make(map[string]*resolverCall),
+		files:     make(map[string]dashboardFileEntry),
+	}
+}
+
+// usesGrafanaAPI returns true if dashboard_url should be resolved using grafana HTTP API
+func usesGrafanaAPI(v DashboardSuggested) bool {
+	return v.DashboardURL == "" && v.DashboardFile == "" && (v.DashboardUID != "" || v.DashboardTitle != "" || v.DashboardTag != "")
+}
+
+// dashboardURLPath matches grafana dashboard URLs. e. /d/<uid>/<slug>
+var dashboardURLPath = regexp.MustCompile(`/d/([^/?#]+)`)
+
+// usesPanelTitle returns true if a panel is chosen by title in panel_title or panels
+func usesPanelTitle(v DashboardSuggested) bool {
+	if v.PanelTitle != "" {
+		return true
+	}
+	for _, p := range v.Panels {
+		if p.PanelTitle != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// resolve returns v with dashboard_url found by dashboard_file, dashboard_uid, dashboard_title or dashboard_tag
+// in grafanaURL (the grafana instance selected for the event), panel titles replaced by panel ids and,
+// if auto_variables is used, all dashboard template variables
+func (r *dashboardResolver) resolve(v DashboardSuggested, grafanaURL string) (DashboardSuggested, []string, error) {
+	var variables []string
+	var panels map[string]int
+	switch {
+	case v.DashboardFile != "":
+		model, err := r.dashboardFile(v.DashboardFile)
+		if err != nil {
+			return v, nil, err
+		}
+		if v.DashboardURL == "" {
+			if v.DashboardURL, err = modelURL(model, grafanaURL); err != nil {
+				return v, nil, err
+			}
+		}
+		variables = model.variables()
+		panels = model.panelIDs()
+	case usesGrafanaAPI(v):
+		apiURL, err := r.apiURL(grafanaURL)
+		if err != nil {
+			return v, nil, err
+		}
+		var key string
+		switch {
+		case v.DashboardUID != "":
+			key = "uid:" + v.DashboardUID
+		case v.DashboardTitle != "":
+			key = "title:" + v.DashboardTitle
+		default:
+			key = "tag:" + v.DashboardTag
+		}
+		entry, err := r.lookup(apiURL, key, func() (resolverCacheEntry, error) {
+			return r.search(apiURL, v)
+		})
+		if err != nil {
+			return v, nil, err
+		}
+		v.DashboardURL = entry.URL
+		variables = entry.Variables
+		panels = entry.Panels
+	case v.AutoVariables || usesPanelTitle(v):
+		match := dashboardURLPath.FindStringSubmatch(v.DashboardURL)
+		if strings.Contains(v.DashboardURL, "{{") || match == nil {
+			return v, nil, fmt.Errorf("auto_variables and panel_title require dashboard_uid, dashboard_title, dashboard_tag, dashboard_file or a dashboard_url like https://grafana.com/d/<uid>")
+		}
+		apiURL, err := r.apiURL(grafanaURL)
+		if err != nil {
+			return v, nil, err
+		}
+		entry, err := r.lookup(apiURL, "uid:"+match[1], func() (resolverCacheEntry, error) {
+			return r.dashboardByUID(apiURL, match[1])
+		})
+		if err != nil {
+			return v, nil, err
+		}
+		variables = entry.Variables
+		panels = entry.Panels
+	}
+	v, err := resolvePanelTitles(v, panels)
+	if err != nil {
+		return v, nil, err
+	}
+	if !v.AutoVariables {
+		return v, nil, nil
+	}
+	return v, variables, nil
+}
+
+// resolvePanelTitles replaces panel_title by its panel_id in v and in a copy of v.Panels
+func resolvePanelTitles(v DashboardSuggested, panels map[string]int) (DashboardSuggested, error) {
+	if !usesPanelTitle(v) {
+		return v, nil
+	}
+	if v.PanelTitle != "" {
+		id, ok := panels[v.PanelTitle]
+		if !ok {
+			return v, fmt.Errorf("panel %s not found in dashboard", v.PanelTitle)
+		}
+		v.PanelID = id
+	}
+	dashboardPanels := append([]DashboardPanel{}, v.Panels...)
+	for i, p := range dashboardPanels {
+		if p.PanelTitle == "" {
+			continue
+		}
+		id, ok := panels[p.PanelTitle]
+		if !ok {
+			return v, fmt.Errorf("panel %s not found in dashboard", p.PanelTitle)
+		}
+		dashboardPanels[i].PanelID = id
+	}
+	v.Panels = dashboardPanels
+	return v, nil
+}
+
+// lookup returns a dashboard from cache or using fetch. Grafana API is called without holding the mutex and
+// only once for concurrent lookups of the same key. If fetch fails, an expired dashboard is used for grafanaAPIBackoff.
+func (r *dashboardResolver) lookup(grafanaURL *url.URL, key string, fetch func() (resolverCacheEntry, error)) (resolverCacheEntry, error) {
+	cacheKey := resolverCacheKey(grafanaURL, key)
+	r.mutex.Lock()
+	r.loadCache()
+	cached, found := r.cache[cacheKey]
+	if found && time.Now().Before(cached.Expires) {
+		r.mutex.Unlock()
+		return cached, nil
+	}
+	if call, ok := r.calls[cacheKey]; ok {
+		r.mutex.Unlock()
+		<-call.done
+		return call.entry, call.err
+	}
+	call := &resolverCall{done: make(chan struct{})}
+	r.calls[cacheKey] = call
+	r.mutex.Unlock()
+
+	entry, err := fetch()
+	r.mutex.Lock()
+	switch {
+	case err != nil && found:
+		// grafana is not available, an expired URL is better than no link
+		cached.Expires = time.Now().Add(grafanaAPIBackoff)
+		r.cache[cacheKey] = cached
+		entry, err = cached, nil
+	case err != nil:
+		err = fmt.Errorf("failed resolving dashboard %s %v", key, err)
+	default:
+		entry.Expires = time.Now().Add(r.ttl)
+		r.cache[cacheKey] = entry
+	}
+	var content []byte
+	if r.cacheFile != "" {
+		// cache file is only used to avoid requests, an error writing it doesn't change the link
+		content, _ = json.Marshal(r.cache)
+	}
+	delete(r.calls, cacheKey)
+	r.mutex.Unlock()
+	call.entry, call.err = entry, err
+	close(call.done)
+	if content != nil {
+		_ = r.saveCache(content)
+	}
+	return entry, err
+}
+
+// grafanaAPIBase returns grafana URL without orgId, used to compare grafana instances
+func grafanaAPIBase(grafanaURL *url.URL) string {
+	return fmt.Sprintf("%s://%s%s", grafanaURL.Scheme, grafanaURL.Host, strings.TrimSuffix(grafanaURL.Path, "/"))
+}
+
+// grafanaAPIBases returns grafanaAPIBase of all valid URLs in urls
+func grafanaAPIBases(urls []string) []string {
+	bases := []string{}
+	for _, s := range urls {
+		if grafanaURL, err := url.Parse(s); err == nil && grafanaURL.Host != "" {
+			bases = append(bases, grafanaAPIBase(grafanaURL))
+		}
+	}
+	return bases
+}
+
+// resolverCacheKey returns key prefixed by grafana URL and orgId, then the same dashboard uid, title or tag
+// in different grafana instances or organizations are cached independently
+func resolverCacheKey(grafanaURL *url.URL, key string) string {
+	return fmt.Sprintf("%s://%s%s|orgId=%s|%s", grafanaURL.Scheme, grafanaURL.Host, strings.TrimSuffix(grafanaURL.Path, "/"), grafanaURL.Query().Get("orgId"), key)
+}
+
+// search calls /api/search to find a dashboard uid by title or tag and then /api/dashboards/uid/<uid>
+func (r *dashboardResolver) search(grafanaURL *url.URL, v DashboardSuggested) (resolverCacheEntry, error) {
+	if v.DashboardUID != "" {
+		return r.dashboardByUID(grafanaURL, v.DashboardUID)
+	}
+	query := url.Values{"type": []string{"dash-db"}}
+	if v.DashboardTitle != "" {
+		query.Set("query", v.DashboardTitle)
+	} else {
+		query.Set("tag", v.DashboardTag)
+	}
+	results := []grafanaSearchResult{}
+	if err := r.get(grafanaURL, "/api/search", query, &results); err != nil {
+		return resolverCacheEntry{}, err
+	}
+	for _, result := range results {
+		// search by title returns all dashboards containing it, only the same title is used
+		if v.DashboardTitle == "" || strings.EqualFold(result.Title, v.DashboardTitle) {
+			return r.dashboardByUID(grafanaURL, result.UID)
+		}
+	}
+	return resolverCacheEntry{}, fmt.Errorf("dashboard not found")
+}
+
+// dashboardByUID calls /api/dashboards/uid/<uid> and returns the dashboard complete URL with orgId, its variables and panels
+func (r *dashboardResolver) dashboardByUID(grafanaURL *url.URL, uid string) (resolverCacheEntry, error) {
+	dashboard := struct {
+		Dashboard dashboardModel `json:"dashboard"`
+		Meta      struct {
+			URL string `json:"url"`
+		} `json:"meta"`
+	}{}
+	if err := r.get(grafanaURL, "/api/dashboards/uid/"+url.PathEscape(uid), nil, &dashboard); err != nil {
+		return resolverCacheEntry{}, err
+	}
+	if dashboard.Meta.URL == "" {
+		return resolverCacheEntry{}, fmt.Errorf("dashboard not found")
+	}
+	// dashboard URL returned by grafana already has grafana sub path
+	dashboardURL := url.URL{Scheme: grafanaURL.Scheme, Host: grafanaURL.Host, Path: dashboard.Meta.URL}
+	values := url.Values{}
+	values.Set("orgId", grafanaURL.Query().Get("orgId"))
+	dashboardURL.RawQuery = values.Encode()
+	return resolverCacheEntry{URL: dashboardURL.String(), Variables: dashboard.Dashboard.variables(), Panels: dashboard.Dashboard.panelIDs()}, nil
+}
+
+// apiURL parses the grafana instance URL used to call grafana API
+func (r *dashboardResolver) apiURL(s string) (*url.URL, error) {
+	grafanaURL, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	if grafanaURL.Host == "" {
+		return nil, fmt.Errorf("--grafana-url is required to use grafana API")
+	}
+	return grafanaURL, nil
+}
+
+// modelURL returns a dashboard URL in grafana instance s using dashboard uid and title, like grafana does
+func modelURL(model dashboardModel, s string) (string, error) {
+	grafanaURL, err := url.Parse(s)
+	if err != nil {
+		return "", err
+	}
+	if grafanaURL.Host == "" {
+		return "", fmt.Errorf("--grafana-url is required to create dashboard URL from dashboard_file")
+	}
+	if model.UID == "" {
+		return "", fmt.Errorf("dashboard %s has no uid", model.Title)
+	}
+	dashboardURL := url.URL{
+		Scheme: grafanaURL.Scheme,
+		Host:   grafanaURL.Host,
+		Path:   fmt.Sprintf("%s/d/%s/%s", strings.TrimSuffix(grafanaURL.Path, "/"), model.UID, slugify(model.Title)),
+	}
+	values := url.Values{}
+	values.Set("orgId", grafanaURL.Query().Get("orgId"))
+	dashboardURL.RawQuery = values.Encode()
+	return dashboardURL.String(), nil
+}
+
+// slugify works like grafana dashboard slug. e. Kubernetes / Pods becomes kubernetes-pods
+func slugify(s string) string {
+	slug := strings.Builder{}
+	dash := false
+	for _, c := range strings.ToLower(s) {
+		if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') {
+			if dash && slug.Len() != 0 {
+				slug.WriteByte('-')
+			}
+			slug.WriteRune(c)
+			dash = false
+			continue
+		}
+		dash = true
+	}
+	return slug.String()
+}
+
+// dashboardFile reads a dashboard JSON model exported from grafana, it is parsed again only if it was changed
+func (r *dashboardResolver) dashboardFile(path string) (dashboardModel, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return dashboardModel{}, fmt.Errorf("failed reading dashboard_file %v", err)
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if entry, ok := r.files[path]; ok && entry.modTime.Equal(info.ModTime()) {
+		return entry.model, nil
+	}
+	model, err := readDashboardModel(path)
+	if err != nil {
+		return model, err
+	}
+	r.files[path] = dashboardFileEntry{modTime: info.ModTime(), model: model}
+	return model, nil
+}
+
+// readDashboardModel parses a dashboard JSON model file or a /api/dashboards/uid/<uid> response saved in a file
+func readDashboardModel(path string) (dashboardModel, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return dashboardModel{}, fmt.Errorf("failed reading dashboard_file %v", err)
+	}
+	dashboard := struct {
+		dashboardModel
+		Dashboard *dashboardModel `json:"dashboard"`
+	}{}
+	if err := json.Unmarshal(content, &dashboard); err != nil {
+		return dashboardModel{}, fmt.Errorf("failed parsing dashboard file %s: %v", path, err)
+	}
+	if dashboard.Dashboard != nil {
+		return *dashboard.Dashboard, nil
+	}
+	return dashboard.dashboardModel, nil
+}
+
+// get calls grafana HTTP API using grafanaURL path as prefix
+func (r *dashboardResolver) get(grafanaURL *url.URL, apiPath string, query url.Values, v interface{}) error {
+	apiURL := url.URL{
+		Scheme:   grafanaURL.Scheme,
+		Host:     grafanaURL.Host,
+		Path:     strings.TrimSuffix(grafanaURL.Path, "/") + apiPath,
+		RawQuery: query.Encode(),
+	}
+	req, err := http.NewRequest(http.MethodGet, apiURL.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	if r.token != "" && containsString(r.tokenURLs, grafanaAPIBase(grafanaURL)) {
+		req.Header.Set("Authorization", "Bearer "+r.token)
+	}
+	if orgID := grafanaURL.Query().Get("orgId"); orgID != "" {
+		req.Header.Set("X-Grafana-Org-Id", orgID)
+	}
+	res, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("dashboard not found")
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("grafana API %s returned status %d", apiPath, res.StatusCode)
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// loadCache reads cache file once, a missing or invalid cache file is ignored
+func (r *dashboardResolver) loadCache() {
+	if r.cacheLoaded || r.cacheFile == "" {
+		return
+	}
+	r.cacheLoaded = true
+	content, err := ioutil.ReadFile(r.cacheFile)
+	if err != nil {
+		return
+	}
+	cache := make(map[string]resolverCacheEntry)
+	if err := json.Unmarshal(content, &cache); err != nil {
+		return
+	}
+	for k, v := range cache {
+		if _, ok := r.cache[k]; !ok {
+			r.cache[k] = v
+		}
+	}
+}
+
+// saveCache writes cache file content using a temporary file, then concurrent mutators never read half written files.
+// The temporary file is created with 0600 permissions, only the user running the mutator can read the cache file.
+func (r *dashboardResolver) saveCache(content []byte) error {
+	if r.cacheFile == "" {
+		return nil
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(r.cacheFile), filepath.Base(r.cacheFile)+".*")
+	if err != nil {
+		return fmt.Errorf("failed writing grafana API cache file %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed writing grafana API cache file %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed writing grafana API cache file %v", err)
+	}
+	if err := os.Rename(tmp.Name(), r.cacheFile); err != nil {
+		return fmt.Errorf("failed writing grafana API cache file %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,362 @@
+package mutator
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	v2 "github.com/sensu/sensu-go/api/core/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// newGrafanaStub returns a grafana API with three dashboards in organization 2, requests counts all API calls
+func newGrafanaStub(t *testing.T, requests *int32) *httptest.Server {
+	mux := http.NewServeMux()
+	dashboards := map[string]string{
+		"nodes":    `{"dashboard":{"uid":"nodes","title":"Kubernetes Nodes","templating":{"list":[{"name":"datasource","type":"datasource"},{"name":"cluster","type":"query"},{"name":"node","type":"query"}]},"panels":[{"id":1,"title":"CPU usage"},{"id":10,"title":"Memory","type":"row","panels":[{"id":12,"title":"Memory usage"}]}]},"meta":{"url":"/grafana/d/nodes/kubernetes-nodes"}}`,
+		"pods":     `{"dashboard":{"uid":"pods","title":"Kubernetes Pods"},"meta":{"url":"/grafana/d/pods/kubernetes-pods"}}`,
+		"pods-old": `{"dashboard":{"uid":"pods-old","title":"Kubernetes Pods (old)"},"meta":{"url":"/grafana/d/pods-old/kubernetes-pods-old"}}`,
+	}
+	mux.HandleFunc("/grafana/api/dashboards/uid/", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		// dashboards are only in organization 2
+		dashboard, ok := dashboards[strings.TrimPrefix(r.URL.Path, "/grafana/api/dashboards/uid/")]
+		if !ok || r.Header.Get("X-Grafana-Org-Id") != "2" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(dashboard))
+	})
+	mux.HandleFunc("/grafana/api/search", func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		assert.Equal(t, "dash-db", r.URL.Query().Get("type"))
+		results := []grafanaSearchResult{}
+		// grafana search by title is case insensitive
+		if strings.EqualFold(r.URL.Query().Get("query"), "Kubernetes Pods") || r.URL.Query().Get("tag") == "kubernetes" {
+			results = append(results,
+				grafanaSearchResult{UID: "pods-old", Title: "Kubernetes Pods (old)", URL: "/grafana/d/pods-old/kubernetes-pods-old", Tags: []string{"kubernetes"}},
+				grafanaSearchResult{UID: "pods", Title: "Kubernetes Pods", URL: "/grafana/d/pods/kubernetes-pods", Tags: []string{"kubernetes"}},
+			)
+		}
+		json.NewEncoder(w).Encode(results)
+	})
+	return httptest.NewServer(mux)
+}
+
+func TestDashboardResolver(t *testing.T) {
+	var requests int32
+	server := newGrafanaStub(t, &requests)
+	defer server.Close()
+	config := DefaultConfig()
+	config.GrafanaURL = server.URL + "/grafana/?orgId=2"
+	config.GrafanaAPIToken = "secret"
+	config.GrafanaAPICacheFile = filepath.Join(t.TempDir(), "dashboards.json")
+	r := newDashboardResolver(config)
+
+	dashboard1, _, err1 := r.resolve(DashboardSuggested{GrafanaAnnotation: "nodes", DashboardUID: "nodes"}, config.GrafanaURL)
+	assert.NoError(t, err1)
+	assert.Equal(t, server.URL+"/grafana/d/nodes/kubernetes-nodes?orgId=2", dashboard1.DashboardURL)
+	dashboard2, _, err2 := r.resolve(DashboardSuggested{GrafanaAnnotation: "pods", DashboardTitle: "kubernetes pods"}, config.GrafanaURL)
+	assert.NoError(t, err2)
+	assert.Equal(t, server.URL+"/grafana/d/pods/kubernetes-pods?orgId=2", dashboard2.DashboardURL)
+	dashboard3, _, err3 := r.resolve(DashboardSuggested{GrafanaAnnotation: "pods", DashboardTag: "kubernetes"}, config.GrafanaURL)
+	assert.NoError(t, err3)
+	assert.Equal(t, server.URL+"/grafana/d/pods-old/kubernetes-pods-old?orgId=2", dashboard3.DashboardURL)
+	_, _, err4 := r.resolve(DashboardSuggested{GrafanaAnnotation: "missing", DashboardUID: "missing"}, config.GrafanaURL)
+	assert.EqualError(t, err4, "failed resolving dashboard uid:missing dashboard not found")
+	_, _, err5 := r.resolve(DashboardSuggested{GrafanaAnnotation: "missing", DashboardTitle: "Missing"}, config.GrafanaURL)
+	assert.Error(t, err5)
+	assert.Equal(t, int32(7), atomic.LoadInt32(&requests))
+
+	// memory cache
+	_, _, err6 := r.resolve(DashboardSuggested{GrafanaAnnotation: "nodes", DashboardUID: "nodes"}, config.GrafanaURL)
+	assert.NoError(t, err6)
+	assert.Equal(t, int32(7), atomic.LoadInt32(&requests))
+
+	// disk cache is used by new mutators
+	content, err := ioutil.ReadFile(config.GrafanaAPICacheFile)
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), `"`+server.URL+`/grafana|orgId=2|uid:nodes"`)
+	r2 := newDashboardResolver(config)
+	dashboard7, _, err7 := r2.resolve(DashboardSuggested{GrafanaAnnotation: "nodes", DashboardUID: "nodes"}, config.GrafanaURL)
+	assert.NoError(t, err7)
+	assert.Equal(t, dashboard1.DashboardURL, dashboard7.DashboardURL)
+	assert.Equal(t, int32(7), atomic.LoadInt32(&requests))
+
+	// expired entries are requested again, or used if grafana is not available
+	expired := `{"` + server.URL + `/grafana|orgId=2|uid:nodes":{"url":"https://grafana-old.example.com/d/nodes/nodes?orgId=2","expires":"2020-01-01T00:00:00Z"}}`
+	assert.NoError(t, ioutil.WriteFile(config.GrafanaAPICacheFile, []byte(expired), 0600))
+	r3 := newDashboardResolver(config)
+	dashboard8, _, err8 := r3.resolve(DashboardSuggested{GrafanaAnnotation: "nodes", DashboardUID: "nodes"}, config.GrafanaURL)
+	assert.NoError(t, err8)
+	assert.Equal(t, dashboard1.DashboardURL, dashboard8.DashboardURL)
+	assert.Equal(t, int32(8), atomic.LoadInt32(&requests))
+	server.Close()
+	assert.NoError(t, ioutil.WriteFile(config.GrafanaAPICacheFile, []byte(expired), 0600))
+	r4 := newDashboardResolver(config)
+	dashboard9, _, err9 := r4.resolve(DashboardSuggested{GrafanaAnnotation: "nodes", DashboardUID: "nodes"}, config.GrafanaURL)
+	assert.NoError(t, err9)
+	assert.Equal(t, "https://grafana-old.example.com/d/nodes/nodes?orgId=2", dashboard9.DashboardURL)
+	// grafana is called again only after backoff
+	apiURL, _ := url.Parse(config.GrafanaURL)
+	assert.True(t, r4.cache[resolverCacheKey(apiURL, "uid:nodes")].Expires.After(time.Now()))
+	_, _, err10 := r4.resolve(DashboardSuggested{GrafanaAnnotation: "pods", DashboardUID: "pods"}, config.GrafanaURL)
+	assert.Error(t, err10)
+}
+
+func TestDashboardResolverCacheKey(t *testing.T) {
+	var requests int32
+	server := newGrafanaStub(t, &requests)
+	defer server.Close()
+	config := DefaultConfig()
+	config.GrafanaURL = server.URL + "/grafana/?orgId=2"
+	config.GrafanaAPIToken = "secret"
+	r := newDashboardResolver(config)
+	// the same uid in other grafana instance or organization is requested again
+	_, _, err1 := r.resolve(DashboardSuggested{GrafanaAnnotation: "nodes", DashboardUID: "nodes"}, server.URL+"/grafana/?orgId=2")
+	assert.NoError(t, err1)
+	_, _, err2 := r.resolve(DashboardSuggested{GrafanaAnnotation: "nodes", DashboardUID: "nodes"}, server.URL+"/grafana/?orgId=3")
+	assert.Error(t, err2)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+	assert.Equal(t, 1, len(r.cache))
+
+	// concurrent lookups for the same key call fetch once
+	var fetches int32
+	release := make(chan struct{})
+	apiURL, _ := url.Parse(server.URL + "/grafana/?orgId=2")
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			entry, err := r.lookup(apiURL, "uid:pods", func() (resolverCacheEntry, error) {
+				atomic.AddInt32(&fetches, 1)
+				<-release
+				return resolverCacheEntry{URL: "https://grafana.com/d/pods?orgId=2"}, nil
+			})
+			assert.NoError(t, err)
+			assert.Equal(t, "https://grafana.com/d/pods?orgId=2", entry.URL)
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fetches))
+}
+
+func TestLinksGrafanaAPIInstance(t *testing.T) {
+	var requests int32
+	server := newGrafanaStub(t, &requests)
+	defer server.Close()
+	config := DefaultConfig()
+	config.GrafanaURL = "https://grafana.invalid/?orgId=1"
+	config.GrafanaAPIToken = "secret"
+	config.GrafanaInstances = []GrafanaInstance{{Name: "eu", MatchLabels: map[string]string{"region": "eu"}, GrafanaURL: server.URL + "/grafana/?orgId=2"}}
+	config.GrafanaDashboardSuggested = []DashboardSuggested{{GrafanaAnnotation: "nodes", DashboardUID: "nodes", Labels: []string{"node"}}}
+	m, err := New(config)
+	assert.NoError(t, err)
+	event := v2.FixtureEvent("entity1", "check1")
+	event.Check.Labels = map[string]string{"node": "node1", "region": "eu"}
+	links, err := m.Links(event)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(links))
+	assert.Contains(t, links[0].URL, server.URL+"/grafana/d/nodes/kubernetes-nodes?orgId=2&from=")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+}
+
+func TestGrafanaAPITokenOverride(t *testing.T) {
+	var requests int32
+	server := newGrafanaStub(t, &requests)
+	defer server.Close()
+	authorization := make(chan string, 2)
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization <- r.Header.Get("Authorization")
+		http.NotFound(w, r)
+	}))
+	defer other.Close()
+	config := DefaultConfig()
+	config.GrafanaURL = server.URL + "/grafana/?orgId=2"
+	config.GrafanaAPIToken = "secret"
+	config.GrafanaDashboardSuggested = []DashboardSuggested{{GrafanaAnnotation: "nodes", DashboardUID: "nodes", Labels: []string{"node"}}}
+	m, err := New(config)
+	assert.NoError(t, err)
+	event := v2.FixtureEvent("entity1", "check1")
+	event.Check.Labels = map[string]string{"node": "node1"}
+
+	// grafana URL overridden by event annotations doesn't receive the token
+	config.GrafanaURL = other.URL + "/?orgId=1"
+	m2, err := m.WithConfig(config)
+	assert.NoError(t, err)
+	_, err = m2.Links(event)
+	assert.Error(t, err)
+	assert.Equal(t, "", <-authorization)
+
+	config.GrafanaAPIURLs = []string{server.URL + "/grafana/"}
+	m3, err := New(config)
+	assert.NoError(t, err)
+	_, err = m3.Links(event)
+	assert.Error(t, err)
+	assert.Equal(t, "", <-authorization)
+}
+
+func TestLinksGrafanaAPI(t *testing.T) {
+	var requests int32
+	server := newGrafanaStub(t, &requests)
+	defer server.Close()
+	config := DefaultConfig()
+	config.GrafanaURL = server.URL + "/grafana/?orgId=2"
+	config.GrafanaAPIToken = "secret"
+	config.GrafanaAPICacheFile = ""
+	config.GrafanaAPICacheTTL = time.Minute
+	config.GrafanaDashboardSuggested = []DashboardSuggested{
+		{GrafanaAnnotation: "nodes", DashboardUID: "nodes", Labels: []string{"node"}},
+		{GrafanaAnnotation: "missing", DashboardUID: "missing", Labels: []string{"node"}},
+	}
+	m, err := New(config)
+	assert.NoError(t, err)
+	event := v2.FixtureEvent("entity1", "check1")
+	event.Check.Labels = map[string]string{"node": "node1"}
+	links, err := m.Links(event)
+	assert.Equal(t, LinkErrors{{Name: "grafana_missing_url", Reason: "failed resolving dashboard uid:missing dashboard not found", Rule: "grafana_missing_url"}}, err)
+	assert.Equal(t, 1, len(links))
+	assert.Contains(t, links[0].URL, server.URL+"/grafana/d/nodes/kubernetes-nodes?orgId=2&from=")
+	assert.Contains(t, links[0].URL, "&var-node=node1")
+}
+
+func TestValidateDashboardSuggestedGrafanaAPI(t *testing.T) {
+	config := DefaultConfig()
+	config.GrafanaDashboardSuggested = []DashboardSuggested{
+		{GrafanaAnnotation: "nodes", DashboardUID: "nodes"},
+		{GrafanaAnnotation: "pods", DashboardURL: "https://grafana.com/d/pods?orgId=1", DashboardTag: "kubernetes"},
+	}
+	problems := config.Validate()
+	assert.Equal(t, 2, len(problems))
+	assert.Contains(t, problems[0].Error(), "use only one of dashboard_url, dashboard_uid, dashboard_title or dashboard_tag")
+	assert.Contains(t, problems[1].Error(), "--grafana-url")
+}
+
+func TestAutoVariables(t *testing.T) {
+	var requests int32
+	server := newGrafanaStub(t, &requests)
+	defer server.Close()
+	dashboardFile := filepath.Join(t.TempDir(), "nodes.json")
+	assert.NoError(t, ioutil.WriteFile(dashboardFile, []byte(`{"uid":"nodes-file","title":"Kubernetes / Nodes","templating":{"list":[{"name":"cluster","type":"custom"},{"name":"filters","type":"adhoc"},{"name":"instance","type":"query"}]}}`), 0600))
+	config := DefaultConfig()
+	config.GrafanaURL = server.URL + "/grafana/?orgId=2"
+	config.GrafanaAPIToken = "secret"
+	config.GrafanaAPICacheFile = ""
+	config.GrafanaDashboardSuggested = []DashboardSuggested{
+		{GrafanaAnnotation: "nodes", DashboardUID: "nodes", Labels: []string{"node"}, AutoVariables: true},
+		{GrafanaAnnotation: "nodes_url", DashboardURL: server.URL + "/grafana/d/nodes/kubernetes-nodes?orgId=2&var-datasource=thanos", AutoVariables: true},
+		{GrafanaAnnotation: "nodes_file", DashboardFile: dashboardFile, Labels: []string{"hostname"}, Variables: map[string]string{"hostname": "instance"}, AutoVariables: true},
+		{GrafanaAnnotation: "nodes_no_auto", DashboardUID: "nodes", Labels: []string{"node"}},
+	}
+	m, err := New(config)
+	assert.NoError(t, err)
+	event := v2.FixtureEvent("entity1", "check1")
+	event.Check.Labels = map[string]string{"node": "node1", "cluster": "eu-1", "hostname": "host1"}
+	links, err := m.Links(event)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, len(links))
+	assert.Regexp(t, `/grafana/d/nodes/kubernetes-nodes\?orgId=2&from=\d+&to=\d+&var-node=node1&var-cluster=eu-1$`, links[0].URL)
+	assert.Regexp(t, `/grafana/d/nodes/kubernetes-nodes\?orgId=2&var-datasource=thanos&from=\d+&to=\d+&var-cluster=eu-1&var-node=node1$`, links[1].URL)
+	assert.Regexp(t, `/grafana/d/nodes-file/kubernetes-nodes\?orgId=2&from=\d+&to=\d+&var-instance=host1&var-cluster=eu-1$`, links[2].URL)
+	assert.Regexp(t, `&var-node=node1$`, links[3].URL)
+	// nodes dashboard is requested only once
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+}
+
+func TestPanelLinks(t *testing.T) {
+	var requests int32
+	server := newGrafanaStub(t, &requests)
+	defer server.Close()
+	config := DefaultConfig()
+	config.GrafanaURL = server.URL + "/grafana/?orgId=2"
+	config.GrafanaAPIToken = "secret"
+	config.GrafanaAPICacheFile = ""
+	config.GrafanaDashboardSuggested = []DashboardSuggested{
+		{GrafanaAnnotation: "nodes", DashboardUID: "nodes", Labels: []string{"node"}, PanelTitle: "CPU usage", Panels: []DashboardPanel{
+			{Alertname: "NodeMemoryHigh", PanelTitle: "Memory usage"},
+			{CheckName: "check-disk", PanelID: 20},
+		}},
+		{GrafanaAnnotation: "nodes_url", DashboardURL: server.URL + "/grafana/d/nodes/kubernetes-nodes?orgId=2", Labels: []string{"node"}, PanelTitle: "Memory usage"},
+		{GrafanaAnnotation: "nodes_id", DashboardURL: "https://grafana.com/d/other/other?orgId=1", Labels: []string{"node"}, PanelID: 4},
+		{GrafanaAnnotation: "nodes_missing", DashboardUID: "nodes", Labels: []string{"node"}, PanelTitle: "Network"},
+	}
+	m, err := New(config)
+	assert.NoError(t, err)
+	event := v2.FixtureEvent("entity1", "check1")
+	event.Check.Labels = map[string]string{"node": "node1"}
+	links1, err1 := m.Links(event)
+	assert.Equal(t, LinkErrors{{Name: "grafana_nodes_missing_url", Reason: "panel Network not found in dashboard", Rule: "grafana_nodes_missing_url"}}, err1)
+	assert.Equal(t, 3, len(links1))
+	assert.Regexp(t, `/grafana/d/nodes/kubernetes-nodes\?orgId=2&from=\d+&to=\d+&var-node=node1&viewPanel=1$`, links1[0].URL)
+	assert.Regexp(t, `/grafana/d/nodes/kubernetes-nodes\?orgId=2&from=\d+&to=\d+&var-node=node1&viewPanel=12$`, links1[1].URL)
+	assert.Regexp(t, `&var-node=node1&viewPanel=4$`, links1[2].URL)
+
+	// panels are chosen by alertname label or check name
+	event.Check.Labels["alertname"] = "NodeMemoryHigh"
+	links2, _ := m.Links(event)
+	assert.Regexp(t, `&viewPanel=12$`, links2[0].URL)
+	delete(event.Check.Labels, "alertname")
+	event.Check.Name = "check-disk"
+	links3, _ := m.Links(event)
+	assert.Regexp(t, `&viewPanel=20$`, links3[0].URL)
+	// configured panels are not changed by resolving panel titles
+	assert.Equal(t, 0, m.config.GrafanaDashboardSuggested[0].Panels[0].PanelID)
+}
+
+func TestReadDashboardModel(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "api.json"), []byte(`{"dashboard":{"uid":"nodes","title":"Nodes","templating":{"list":[{"name":"node","type":"query"},{"name":"prefix","type":"constant"}]}},"meta":{}}`), 0600))
+	model, err := readDashboardModel(filepath.Join(dir, "api.json"))
+	assert.NoError(t, err)
+	assert.Equal(t, "nodes", model.UID)
+	assert.Equal(t, []string{"node"}, model.variables())
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "panels.json"), []byte(`{"uid":"panels","panels":[{"id":1,"title":"CPU"},{"id":2,"title":"Disk","type":"row","panels":[{"id":3,"title":"Disk usage"},{"id":4,"title":"CPU"}]}]}`), 0600))
+	model2, err := readDashboardModel(filepath.Join(dir, "panels.json"))
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{"CPU": 1, "Disk": 2, "Disk usage": 3}, model2.panelIDs())
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "broken.json"), []byte(`{`), 0600))
+	_, err2 := readDashboardModel(filepath.Join(dir, "broken.json"))
+	assert.Error(t, err2)
+	_, err3 := readDashboardModel(filepath.Join(dir, "missing.json"))
+	assert.Error(t, err3)
+}
+
+func TestSlugify(t *testing.T) {
+	assert.Equal(t, "kubernetes-compute-resources-namespace-pods", slugify("Kubernetes / Compute Resources / Namespace (Pods)"))
+	assert.Equal(t, "node-exporter-full", slugify("Node Exporter Full"))
+}
+
+func TestValidateAutoVariables(t *testing.T) {
+	config := DefaultConfig()
+	config.GrafanaURL = "https://grafana.com/?orgId=1"
+	config.GrafanaDashboardSuggested = []DashboardSuggested{
+		{GrafanaAnnotation: "nodes", DashboardURL: "https://grafana.com/d/nodes/nodes?orgId=1", AutoVariables: true},
+		{GrafanaAnnotation: "pods", DashboardURL: "{{ .GrafanaURL }}&var-pod={{ .Labels.pod }}", AutoVariables: true},
+		{GrafanaAnnotation: "files", DashboardFile: filepath.Join(t.TempDir(), "missing.json")},
+		{GrafanaAnnotation: "both", DashboardFile: "nodes.json", DashboardUID: "nodes"},
+	}
+	problems := config.Validate()
+	assert.Equal(t, 4, len(problems))
+	assert.Contains(t, problems[0].Error(), "auto_variables with dashboard_url requires a dashboard_url without templates")
+	assert.Contains(t, problems[1].Error(), "dashboard_file cannot be used with dashboard_uid")
+	assert.Contains(t, problems[2].Error(), "grafana-dashboard-suggested (files): failed reading dashboard_file")
+	assert.Contains(t, problems[3].Error(), "grafana-dashboard-suggested (both): failed reading dashboard_file")
+
+	m := &Mutator{config: DefaultConfig()}
+	event := v2.FixtureEvent("entity1", "check1")
+	event.Check.Annotations = map[string]string{"sensu.io/plugins/sensu-grafana-mutator/config/dashboard-suggested-add": `[{"grafana_annotation":"secrets","dashboard_file":"/etc/sensu/secrets.json"}]`}
+	_, err := m.dashboardsSuggestedForEvent(event)
+	assert.EqualError(t, err, "annotation sensu.io/plugins/sensu-grafana-mutator/config/dashboard-suggested-add: dashboard_file is not allowed in annotations")
+}
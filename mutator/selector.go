@@ -0,0 +1,209 @@
+package mutator
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/sensu/sensu-go/types"
+)
+
+// labelMatcher is one matcher from a match_selectors entry. e. alertname=~Kube.*
+type labelMatcher struct {
+	Key    string
+	Op     string
+	Values []string
+	Regex  *regexp.Regexp
+}
+
+var (
+	setMatcherRegex      = regexp.MustCompile(`^([^=!~\s]+)\s+(in|notin)\s*\((.*)\)$`)
+	operatorMatcherRegex = regexp.MustCompile(`^([^=!~\s]+)\s*(=~|!~|!=|==|=)\s*(.*)$`)
+	labelKeyRegex        = regexp.MustCompile(`^[^=!~\s(),]+$`)
+)
+
+// matchDashboardSuggested returns true if event matches match_labels (all of them),
+// one of match_selectors and expression. Empty fields are ignored.
+func matchDashboardSuggested(event *types.Event, d DashboardSuggested) (bool, error) {
+	if d.MatchLabels != nil && !searchMatchLabels(event, d.MatchLabels) {
+		return false, nil
+	}
+	if len(d.MatchSelectors) != 0 {
+		matched, err := searchMatchSelectors(event, d.MatchSelectors)
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+	if d.Expression != "" {
+		return evaluateExpression(event, d.Expression)
+	}
+	return true, nil
+}
+
+// searchMatchSelectors works as OR between selectors and as AND between matchers inside one selector
+func searchMatchSelectors(event *types.Event, selectors []string) (bool, error) {
+	for _, selector := range selectors {
+		matchers, err := parseSelector(selector)
+		if err != nil {
+			return false, err
+		}
+		if matchSelector(event, matchers) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func matchSelector(event *types.Event, matchers []labelMatcher) bool {
+	for _, m := range matchers {
+		value, found := extractLabels(event, m.Key)
+		switch m.Op {
+		case "exists":
+			if !found {
+				return false
+			}
+		case "!exists":
+			if found {
+				return false
+			}
+		case "=":
+			if !found || value != m.Values[0] {
+				return false
+			}
+		case "!=":
+			if value == m.Values[0] {
+				return false
+			}
+		case "=~":
+			if !m.Regex.MatchString(value) {
+				return false
+			}
+		case "!~":
+			if m.Regex.MatchString(value) {
+				return false
+			}
+		case "in":
+			if !found || !containsString(m.Values, value) {
+				return false
+			}
+		case "notin":
+			if found && containsString(m.Values, value) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// parseSelector parses a comma separated list of matchers like kubernetes label selectors and alertmanager matchers.
+// e. alertname=~"Kube.*",namespace notin (kube-system,monitoring),severity
+func parseSelector(selector string) ([]labelMatcher, error) {
+	matchers := []labelMatcher{}
+	for _, s := range splitSelector(selector) {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		m, err := parseMatcher(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid match selector %q: %v", selector, err)
+		}
+		matchers = append(matchers, m)
+	}
+	if len(matchers) == 0 {
+		return nil, fmt.Errorf("empty match selector %q", selector)
+	}
+	return matchers, nil
+}
+
+func parseMatcher(s string) (labelMatcher, error) {
+	if match := setMatcherRegex.FindStringSubmatch(s); match != nil {
+		values := []string{}
+		for _, v := range splitSelector(match[3]) {
+			v, err := unquote(strings.TrimSpace(v))
+			if err != nil {
+				return labelMatcher{}, err
+			}
+			if v != "" {
+				values = append(values, v)
+			}
+		}
+		return labelMatcher{Key: match[1], Op: match[2], Values: values}, nil
+	}
+	if match := operatorMatcherRegex.FindStringSubmatch(s); match != nil {
+		value, err := unquote(strings.TrimSpace(match[3]))
+		if err != nil {
+			return labelMatcher{}, err
+		}
+		m := labelMatcher{Key: match[1], Op: match[2], Values: []string{value}}
+		if m.Op == "==" {
+			m.Op = "="
+		}
+		if m.Op == "=~" || m.Op == "!~" {
+			// anchored as prometheus and alertmanager do
+			re, err := regexp.Compile(fmt.Sprintf("^(?:%s)$", m.Values[0]))
+			if err != nil {
+				return m, err
+			}
+			m.Regex = re
+		}
+		return m, nil
+	}
+	if strings.HasPrefix(s, "!") && labelKeyRegex.MatchString(strings.TrimSpace(s[1:])) {
+		return labelMatcher{Key: strings.TrimSpace(s[1:]), Op: "!exists"}, nil
+	}
+	if labelKeyRegex.MatchString(s) {
+		return labelMatcher{Key: s, Op: "exists"}, nil
+	}
+	return labelMatcher{}, fmt.Errorf("cannot parse matcher %q", s)
+}
+
+// splitSelector splits by commas outside parentheses and quotes
+func splitSelector(s string) []string {
+	parts := []string{}
+	depth := 0
+	quoted := false
+	escaped := false
+	start := 0
+	for i, c := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case c == '\\' && quoted:
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case c == '(' && !quoted:
+			depth++
+		case c == ')' && !quoted && depth > 0:
+			depth--
+		case c == ',' && !quoted && depth == 0:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// unquote returns a double quoted value like Go, LogQL and PromQL strings, then values written by strconv.Quote
+// are the same. e. "api-\\d+" is api-\d+. Values without quotes are returned as they are
+func unquote(s string) (string, error) {
+	if len(s) < 2 || s[0] != '"' || s[len(s)-1] != '"' {
+		return s, nil
+	}
+	value, err := strconv.Unquote(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid quoted value %s, use \\\\ for backslash", s)
+	}
+	return value, nil
+}
+
+func containsString(slice []string, s string) bool {
+	for _, v := range slice {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
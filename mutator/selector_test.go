@@ -0,0 +1,77 @@
+package mutator
+
+import (
+	"testing"
+
+	v2 "github.com/sensu/sensu-go/api/core/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSelector(t *testing.T) {
+	matchers1, err1 := parseSelector(`alertname=~"Kube.*", namespace notin (kube-system,monitoring),severity!=info,pod,!job`)
+	assert.NoError(t, err1)
+	assert.Equal(t, 5, len(matchers1))
+	assert.Equal(t, "=~", matchers1[0].Op)
+	assert.Equal(t, "notin", matchers1[1].Op)
+	assert.Equal(t, []string{"kube-system", "monitoring"}, matchers1[1].Values)
+	assert.Equal(t, "!=", matchers1[2].Op)
+	assert.Equal(t, "exists", matchers1[3].Op)
+	assert.Equal(t, "!exists", matchers1[4].Op)
+	matchers2, err2 := parseSelector(`namespace in ("x,y",z),pod notin ("a\"b")`)
+	assert.NoError(t, err2)
+	assert.Equal(t, 2, len(matchers2))
+	assert.Equal(t, []string{"x,y", "z"}, matchers2[0].Values)
+	assert.Equal(t, []string{`a"b`}, matchers2[1].Values)
+	_, err2 = parseSelector("alertname=~Kube(")
+	assert.Error(t, err2)
+	_, err3 := parseSelector("")
+	assert.Error(t, err3)
+	_, err4 := parseSelector("alert name")
+	assert.Error(t, err4)
+}
+
+func TestSearchMatchSelectors(t *testing.T) {
+	event1 := v2.FixtureEvent("entity1", "check1")
+	event1.Labels["alertname"] = "KubePodCrashLooping"
+	event1.Labels["namespace"] = "default"
+	event1.Labels["severity"] = "critical"
+
+	res1, err1 := searchMatchSelectors(event1, []string{`alertname=~"Kube.*",namespace notin (kube-system,monitoring)`})
+	assert.NoError(t, err1)
+	assert.True(t, res1)
+
+	event1.Labels["namespace"] = "kube-system"
+	res2, err2 := searchMatchSelectors(event1, []string{`alertname=~"Kube.*",namespace notin (kube-system,monitoring)`})
+	assert.NoError(t, err2)
+	assert.False(t, res2)
+
+	// OR between selectors
+	res3, err3 := searchMatchSelectors(event1, []string{`alertname=Other`, `severity in (critical,warning),!silenced`})
+	assert.NoError(t, err3)
+	assert.True(t, res3)
+
+	res4, err4 := searchMatchSelectors(event1, []string{`alertname!~Kube.*`, `pod`})
+	assert.NoError(t, err4)
+	assert.False(t, res4)
+
+	_, err5 := searchMatchSelectors(event1, []string{`alertname=~Kube(`})
+	assert.Error(t, err5)
+}
+
+func TestMatchDashboardSuggested(t *testing.T) {
+	event1 := v2.FixtureEvent("entity1", "check1")
+	event1.Labels["alertname"] = "KubePodCrashLooping"
+	event1.Labels["namespace"] = "default"
+	res1, err1 := matchDashboardSuggested(event1, DashboardSuggested{MatchLabels: map[string]string{"namespace": "default"}, MatchSelectors: []string{"alertname=~Kube.*"}})
+	assert.NoError(t, err1)
+	assert.True(t, res1)
+	res2, err2 := matchDashboardSuggested(event1, DashboardSuggested{MatchLabels: map[string]string{"namespace": "other"}, MatchSelectors: []string{"alertname=~Kube.*"}})
+	assert.NoError(t, err2)
+	assert.False(t, res2)
+	res3, err3 := matchDashboardSuggested(event1, DashboardSuggested{})
+	assert.NoError(t, err3)
+	assert.True(t, res3)
+	res4, err4 := matchDashboardSuggested(event1, DashboardSuggested{MatchSelectors: []string{"alertname=~Kube.*"}, Expression: "event.check.status == 1"})
+	assert.NoError(t, err4)
+	assert.False(t, res4)
+}
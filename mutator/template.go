@@ -0,0 +1,89 @@
+package mutator
+
+import (
+	"bytes"
+	"strings"
+	"text/template"
+
+	"github.com/sensu/sensu-go/types"
+)
+
+// TemplateData struct is used to render dashboard_url and grafana_annotation as go templates
+type TemplateData struct {
+	Labels     map[string]string
+	EntityName string
+	CheckName  string
+	Namespace  string
+	Status     uint32
+	Timestamp  int64
+	FromDate   int64
+	ToDate     int64
+	GrafanaURL string
+	Event      *types.Event
+}
+
+var templateFuncs = template.FuncMap{
+	"lower":      strings.ToLower,
+	"upper":      strings.ToUpper,
+	"trimDomain": trimDomain,
+	"default":    defaultValue,
+}
+
+// newTemplateData merges event, entity and check labels using the same precedence from extractLabels
+func newTemplateData(event *types.Event, fromDate, toDate int64) TemplateData {
+	labels := make(map[string]string)
+	data := TemplateData{
+		Labels:    labels,
+		Timestamp: event.Timestamp,
+		FromDate:  fromDate,
+		ToDate:    toDate,
+		Event:     event,
+	}
+	for k, v := range event.Labels {
+		labels[k] = v
+	}
+	if event.Entity != nil {
+		for k, v := range event.Entity.Labels {
+			labels[k] = v
+		}
+		data.EntityName = event.Entity.Name
+		data.Namespace = event.Entity.Namespace
+	}
+	if event.Check != nil {
+		for k, v := range event.Check.Labels {
+			labels[k] = v
+		}
+		data.CheckName = event.Check.Name
+		data.Status = event.Check.Status
+	}
+	return data
+}
+
+// renderTemplate returns s unchanged if it isn't a go template
+func renderTemplate(s string, data TemplateData) (string, error) {
+	if !strings.Contains(s, "{{") {
+		return s, nil
+	}
+	tmpl, err := template.New("").Funcs(templateFuncs).Option("missingkey=zero").Parse(s)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// trimDomain removes domain from a FQDN. e. ip-10-192-172-1.eu-west-1.compute.internal returns ip-10-192-172-1
+func trimDomain(s string) string {
+	return strings.Split(s, ".")[0]
+}
+
+// defaultValue returns def if value is empty. e. {{ .Labels.cluster | default "main" }}
+func defaultValue(def, value string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
@@ -0,0 +1,38 @@
+package mutator
+
+import (
+	"testing"
+
+	v2 "github.com/sensu/sensu-go/api/core/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	event1 := v2.FixtureEvent("entity1", "check1")
+	event1.Labels["dashboard_uid"] = "85a562078cdf77779eaa1add43ccec1e"
+	event1.Entity.Labels = map[string]string{"node": "ip-10-192-172-1.eu-west-1.compute.internal"}
+	event1.Check.Labels = map[string]string{"Service": "API Gateway"}
+	data := newTemplateData(event1, 1606487400000, 1606487700000)
+
+	result1, err1 := renderTemplate("https://grafana.com/d/{{.Labels.dashboard_uid}}/node?orgId=1&var-instance={{.Labels.node | trimDomain}}", data)
+	assert.NoError(t, err1)
+	assert.Equal(t, "https://grafana.com/d/85a562078cdf77779eaa1add43ccec1e/node?orgId=1&var-instance=ip-10-192-172-1", result1)
+
+	result2, err2 := renderTemplate("{{.CheckName}}_{{.EntityName | lower}}", data)
+	assert.NoError(t, err2)
+	assert.Equal(t, "check1_entity1", result2)
+
+	result3, err3 := renderTemplate("var-service={{.Labels.Service | urlquery}}&var-cluster={{.Labels.cluster | default \"main\"}}", data)
+	assert.NoError(t, err3)
+	assert.Equal(t, "var-service=API+Gateway&var-cluster=main", result3)
+
+	result4, err4 := renderTemplate("https://grafana.com/?orgId=1", data)
+	assert.NoError(t, err4)
+	assert.Equal(t, "https://grafana.com/?orgId=1", result4)
+
+	_, err5 := renderTemplate("{{.Labels.dashboard_uid", data)
+	assert.Error(t, err5)
+
+	_, err6 := renderTemplate("{{.Unknown}}", data)
+	assert.Error(t, err6)
+}
@@ -0,0 +1,306 @@
+package mutator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// Validate returns all problems found in config, it doesn't stop in the first problem
+func (c Config) Validate() []error {
+	_, problems := c.validate(true)
+	return problems
+}
+
+// validate returns all problems found in config and, if index is true, dashboards found in --grafana-dashboards-dir
+func (c Config) validate(index bool) ([]DashboardSuggested, []error) {
+	var indexed []DashboardSuggested
+	problems := []error{}
+	if len(c.GrafanaDashboardSuggested) == 0 && c.GrafanaDashboardsDir == "" && !c.GrafanaExploreLinkEnabled && !c.GrafanaPrometheusLinkEnabled && !c.GrafanaTempoLinkEnabled && !c.GrafanaExploreSplitEnabled && len(c.LinkProviders) == 0 {
+		problems = append(problems, fmt.Errorf("please choose one of these flags --grafana-dashboard-suggested, --grafana-dashboards-dir, --grafana-explore-link-enabled, --grafana-prometheus-link-enabled, --grafana-tempo-link-enabled or --grafana-explore-split-enabled"))
+	}
+	for _, name := range c.LinkProviders {
+		if !containsString(Providers(), name) {
+			problems = append(problems, fmt.Errorf("invalid link provider %s in LinkProviders: only %s are registered", name, strings.Join(Providers(), ", ")))
+		} else if isBuiltinProvider(name) {
+			problems = append(problems, fmt.Errorf("invalid link provider %s in LinkProviders: built-in providers are enabled by their own flags", name))
+		}
+	}
+	if c.GrafanaExploreLinkEnabled && c.GrafanaURL == "" {
+		problems = append(problems, fmt.Errorf("using --grafana-explore-link-enabled then --grafana-url or GRAFANA_URL environment variable is required"))
+	}
+	if c.GrafanaPrometheusLinkEnabled && c.GrafanaURL == "" {
+		problems = append(problems, fmt.Errorf("using --grafana-prometheus-link-enabled then --grafana-url or GRAFANA_URL environment variable is required"))
+	}
+	if c.GrafanaExploreSplitEnabled {
+		if c.GrafanaURL == "" {
+			problems = append(problems, fmt.Errorf("using --grafana-explore-split-enabled then --grafana-url or GRAFANA_URL environment variable is required"))
+		}
+		if len(c.GrafanaExploreSplitPanes) != 2 {
+			problems = append(problems, fmt.Errorf("--grafana-explore-split-panes should have two panes. e. loki,prometheus"))
+		}
+		for _, pane := range c.GrafanaExploreSplitPanes {
+			if pane != "loki" && pane != "prometheus" && pane != "tempo" {
+				problems = append(problems, fmt.Errorf("invalid pane %s in --grafana-explore-split-panes: only loki, prometheus or tempo are allowed", pane))
+			}
+		}
+	}
+	if c.GrafanaTempoLinkEnabled && c.GrafanaURL == "" {
+		problems = append(problems, fmt.Errorf("using --grafana-tempo-link-enabled then --grafana-url or GRAFANA_URL environment variable is required"))
+	}
+	if c.GrafanaTempoLinkEnabled || (c.GrafanaExploreSplitEnabled && containsString(c.GrafanaExploreSplitPanes, "tempo")) {
+		if _, err := regexp.Compile(c.TempoTraceIDRegex); err != nil {
+			problems = append(problems, fmt.Errorf("invalid --tempo-trace-id-regex %v", err))
+		}
+	}
+	switch c.GrafanaExploreURLVersion {
+	case "", ExploreURLLegacy, ExploreURLPanes:
+	default:
+		problems = append(problems, fmt.Errorf("invalid --grafana-explore-url-version %s: only %s or %s are allowed", c.GrafanaExploreURLVersion, ExploreURLLegacy, ExploreURLPanes))
+	}
+	for _, err := range validateGrafanaInstances(c.GrafanaInstances) {
+		problems = append(problems, fmt.Errorf("invalid --grafana-instances %v", err))
+	}
+	if _, err := parseStreamMatchers(c.LokiStreamMatchers); err != nil {
+		problems = append(problems, fmt.Errorf("invalid --loki-stream-matchers %v", err))
+	}
+	problems = append(problems, validateDashboardSuggested(c.GrafanaDashboardSuggested)...)
+	for _, v := range c.GrafanaDashboardSuggested {
+		if needsGrafanaURL(v) && c.GrafanaURL == "" {
+			problems = append(problems, fmt.Errorf("using dashboard_uid, dashboard_title, dashboard_tag, dashboard_file, auto_variables or panel_title in --grafana-dashboard-suggested then --grafana-url or GRAFANA_URL environment variable is required"))
+			break
+		}
+	}
+	for _, v := range c.GrafanaDashboardSuggested {
+		if v.DashboardFile == "" {
+			continue
+		}
+		if _, err := readDashboardModel(v.DashboardFile); err != nil {
+			problems = append(problems, fmt.Errorf("grafana-dashboard-suggested (%s): %v", v.GrafanaAnnotation, err))
+		}
+	}
+	if c.GrafanaDashboardsDir != "" {
+		if c.GrafanaURL == "" {
+			problems = append(problems, fmt.Errorf("using --grafana-dashboards-dir then --grafana-url or GRAFANA_URL environment variable is required"))
+		}
+		if info, err := os.Stat(c.GrafanaDashboardsDir); err != nil || !info.IsDir() {
+			problems = append(problems, fmt.Errorf("invalid --grafana-dashboards-dir %s: it should be a directory", c.GrafanaDashboardsDir))
+		} else if index {
+			var dirProblems []error
+			indexed, dirProblems = indexDashboardsDir(c.GrafanaDashboardsDir, c.GrafanaDashboardsTag)
+			for _, err := range dirProblems {
+				problems = append(problems, fmt.Errorf("grafana-dashboards-dir: %v", err))
+			}
+		}
+	}
+	if c.GrafanaRenderImages {
+		if c.GrafanaRenderWidth <= 0 || c.GrafanaRenderHeight <= 0 {
+			problems = append(problems, fmt.Errorf("invalid --grafana-render-width %d or --grafana-render-height %d: they should be positive", c.GrafanaRenderWidth, c.GrafanaRenderHeight))
+		}
+		if c.GrafanaRenderTheme != "light" && c.GrafanaRenderTheme != "dark" {
+			problems = append(problems, fmt.Errorf("invalid --grafana-render-theme %s: only light or dark are allowed", c.GrafanaRenderTheme))
+		}
+	}
+	if c.GrafanaAPICacheTTL < 0 {
+		problems = append(problems, fmt.Errorf("invalid --grafana-api-cache-ttl %s: it should be zero or positive", c.GrafanaAPICacheTTL))
+	}
+	return indexed, problems
+}
+
+// ParseGrafanaInstances parses a json list of grafana instances and rejects unknown fields
+func ParseGrafanaInstances(s string) ([]GrafanaInstance, error) {
+	instances := []GrafanaInstance{}
+	if s == "" {
+		return instances, nil
+	}
+	if err := decodeStrictJSON([]byte(s), &instances); err != nil {
+		return nil, err
+	}
+	return instances, nil
+}
+
+// validateGrafanaInstances returns all problems found in a list of grafana instances
+func validateGrafanaInstances(instances []GrafanaInstance) []error {
+	problems := []error{}
+	for i, instance := range instances {
+		if instance.Name == "" {
+			problems = append(problems, fmt.Errorf("grafana instance %d: name is required", i))
+		}
+		if len(instance.MatchLabels) == 0 && len(instance.Namespaces) == 0 {
+			problems = append(problems, fmt.Errorf("grafana instance %s: match_labels or namespaces is required", instance.Name))
+		}
+		grafanaURL, err := url.Parse(instance.GrafanaURL)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("grafana instance %s: %v", instance.Name, err))
+		} else if grafanaURL.Host == "" || !checkMissingOrgID(grafanaURL.Query()) {
+			problems = append(problems, fmt.Errorf("grafana instance %s: grafana_url should be a complete URL with orgId. e. https://grafana.com/?orgId=1", instance.Name))
+		}
+	}
+	return problems
+}
+
+// ParseDashboardSuggested parses a json list of dashboards and rejects unknown fields
+func ParseDashboardSuggested(s string) ([]DashboardSuggested, error) {
+	dashboardSuggested := []DashboardSuggested{}
+	if s == "" {
+		return dashboardSuggested, nil
+	}
+	if err := decodeStrictJSON([]byte(s), &dashboardSuggested); err != nil {
+		return nil, err
+	}
+	return dashboardSuggested, nil
+}
+
+// decodeStrictJSON works like json.Unmarshal but returns an error for unknown fields
+func decodeStrictJSON(content []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+// validateDashboardSuggested returns all problems found in a list of dashboards
+func validateDashboardSuggested(dashboards []DashboardSuggested) []error {
+	problems := []error{}
+	seen := make(map[string]int)
+	for i, v := range dashboards {
+		name := strings.TrimSpace(v.GrafanaAnnotation)
+		problem := func(format string, a ...interface{}) {
+			problems = append(problems, fmt.Errorf("grafana-dashboard-suggested %d (%s): %s", i, name, fmt.Sprintf(format, a...)))
+		}
+		if name == "" {
+			problem("grafana_annotation is required")
+		} else if strings.Contains(name, "{{") {
+			if err := parseTemplate(name); err != nil {
+				problem("invalid grafana_annotation template %v", err)
+			}
+		} else {
+			output := strings.ToLower(name)
+			if first, ok := seen[output]; ok {
+				problem("duplicated grafana_annotation, already used by grafana-dashboard-suggested %d", first)
+			} else {
+				seen[output] = i
+			}
+		}
+		dashboardRefs := 0
+		for _, ref := range []string{v.DashboardURL, v.DashboardUID, v.DashboardTitle, v.DashboardTag} {
+			if ref != "" {
+				dashboardRefs++
+			}
+		}
+		switch {
+		case dashboardRefs > 1:
+			problem("use only one of dashboard_url, dashboard_uid, dashboard_title or dashboard_tag")
+		case v.DashboardFile != "" && v.DashboardURL == "" && dashboardRefs != 0:
+			problem("dashboard_file cannot be used with dashboard_uid, dashboard_title or dashboard_tag")
+		case dashboardRefs == 1 && v.DashboardURL == "":
+			// dashboard_url is found using grafana API
+		case v.DashboardURL == "" && v.DashboardFile != "":
+			// dashboard_url is created using dashboard_file uid
+		case v.DashboardURL == "":
+			problem("dashboard_url is required, or one of dashboard_uid, dashboard_title, dashboard_tag or dashboard_file")
+		case strings.Contains(v.DashboardURL, "{{"):
+			if err := parseTemplate(v.DashboardURL); err != nil {
+				problem("invalid dashboard_url template %v", err)
+			}
+		default:
+			dashboardURL, err := url.Parse(v.DashboardURL)
+			if err != nil {
+				problem("invalid dashboard_url %v", err)
+			} else if dashboardURL.Host == "" || !checkMissingOrgID(dashboardURL.Query()) {
+				problem("dashboard_url should be a complete URL with orgId. e. https://grafana.com/d/uid/name?orgId=1")
+			}
+		}
+		if v.DashboardFile == "" && dashboardRefs == 1 && v.DashboardURL != "" &&
+			(strings.Contains(v.DashboardURL, "{{") || !dashboardURLPath.MatchString(v.DashboardURL)) {
+			if v.AutoVariables {
+				problem("auto_variables with dashboard_url requires a dashboard_url without templates like https://grafana.com/d/<uid>")
+			}
+			if usesPanelTitle(v) {
+				problem("panel_title with dashboard_url requires a dashboard_url without templates like https://grafana.com/d/<uid>")
+			}
+		}
+		if v.PanelID != 0 && v.PanelTitle != "" {
+			problem("use only one of panel_id or panel_title")
+		}
+		if v.PanelID < 0 {
+			problem("invalid panel_id %d", v.PanelID)
+		}
+		for j, p := range v.Panels {
+			switch {
+			case p.Alertname == "" && p.CheckName == "":
+				problem("panels %d: alertname or check_name is required", j)
+			case p.Alertname != "" && p.CheckName != "":
+				problem("panels %d: use only one of alertname or check_name", j)
+			}
+			switch {
+			case p.PanelID == 0 && p.PanelTitle == "":
+				problem("panels %d: panel_id or panel_title is required", j)
+			case p.PanelID != 0 && p.PanelTitle != "":
+				problem("panels %d: use only one of panel_id or panel_title", j)
+			case p.PanelID < 0:
+				problem("panels %d: invalid panel_id %d", j, p.PanelID)
+			}
+		}
+		if v.Labels != nil && len(v.Labels) == 0 {
+			problem("labels is empty")
+		}
+		for variable := range v.Variables {
+			if !containsString(v.Labels, variable) {
+				problem("variables %s is not in labels", variable)
+			}
+		}
+		if v.MatchLabels != nil && len(v.MatchLabels) == 0 {
+			problem("match_labels is empty")
+		}
+		if v.MatchSelectors != nil && len(v.MatchSelectors) == 0 {
+			problem("match_selectors is empty")
+		}
+		for _, selector := range v.MatchSelectors {
+			matchers, err := parseSelector(selector)
+			if err != nil {
+				problem("%v", err)
+			} else if len(matchers) == 0 {
+				problem("empty match selector")
+			}
+		}
+		if v.Expression != "" {
+			if err := compileExpression(v.Expression); err != nil {
+				problem("%v", err)
+			}
+		}
+	}
+	return problems
+}
+
+// needsGrafanaURL returns true if grafana API is used or dashboard_url is created from dashboard_file
+func needsGrafanaURL(v DashboardSuggested) bool {
+	return usesGrafanaAPI(v) || (v.DashboardFile != "" && v.DashboardURL == "") || ((v.AutoVariables || usesPanelTitle(v)) && v.DashboardFile == "")
+}
+
+// parseTemplate checks a go template syntax without rendering it
+func parseTemplate(s string) error {
+	_, err := template.New("").Funcs(templateFuncs).Parse(s)
+	return err
+}
+
+// Problems has all problems found in config, New returns them as one error
+type Problems []error
+
+// Error returns all problems in one message
+func (p Problems) Error() string {
+	messages := []string{}
+	for _, err := range p {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "; ")
+}
+
+// JoinErrors returns all problems as one error
+func JoinErrors(problems []error) error {
+	return Problems(problems)
+}
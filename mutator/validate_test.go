@@ -0,0 +1,43 @@
+package mutator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateDashboardSuggested(t *testing.T) {
+	test1 := []DashboardSuggested{
+		{GrafanaAnnotation: "{{ .CheckName }}", DashboardURL: "{{ .GrafanaURL }}&var-check={{ .CheckName }}"},
+		{GrafanaAnnotation: "alerts", DashboardURL: "https://grafana.com/d/alerts?orgId=1", MatchLabels: map[string]string{"alertname": "Watchdog"}},
+	}
+	assert.Empty(t, validateDashboardSuggested(test1))
+	test2 := []DashboardSuggested{
+		{GrafanaAnnotation: "", DashboardURL: ""},
+		{GrafanaAnnotation: "broken", DashboardURL: "{{ .CheckName ", MatchLabels: map[string]string{}, MatchSelectors: []string{"region in (eu"}},
+		{GrafanaAnnotation: "expression", DashboardURL: "https://grafana.com/d/uid?orgId=1", Labels: []string{"cluster"}, Variables: map[string]string{"pod": "pod_name"}, Expression: "event.check.status ==="},
+	}
+	problems := validateDashboardSuggested(test2)
+	assert.Equal(t, 7, len(problems))
+	assert.Contains(t, problems[0].Error(), "grafana_annotation is required")
+	assert.Contains(t, problems[1].Error(), "dashboard_url is required")
+}
+
+func TestValidateDashboardPanels(t *testing.T) {
+	test1 := []DashboardSuggested{
+		{GrafanaAnnotation: "nodes", DashboardURL: "https://grafana.com/d/nodes?orgId=1", PanelTitle: "CPU", Panels: []DashboardPanel{{Alertname: "NodeMemoryHigh", PanelID: 2}}},
+	}
+	assert.Empty(t, validateDashboardSuggested(test1))
+	test2 := []DashboardSuggested{
+		{GrafanaAnnotation: "both", DashboardURL: "https://grafana.com/d/nodes?orgId=1", PanelID: 1, PanelTitle: "CPU"},
+		{GrafanaAnnotation: "template", DashboardURL: "{{ .GrafanaURL }}", PanelTitle: "CPU"},
+		{GrafanaAnnotation: "panels", DashboardURL: "https://grafana.com/d/nodes?orgId=1", Panels: []DashboardPanel{{PanelID: 2}, {Alertname: "NodeDown", CheckName: "check-node", PanelID: -1}}},
+	}
+	problems := validateDashboardSuggested(test2)
+	assert.Equal(t, 5, len(problems))
+	assert.Contains(t, problems[0].Error(), "use only one of panel_id or panel_title")
+	assert.Contains(t, problems[1].Error(), "panel_title with dashboard_url requires a dashboard_url without templates")
+	assert.Contains(t, problems[2].Error(), "panels 0: alertname or check_name is required")
+	assert.Contains(t, problems[3].Error(), "panels 1: use only one of alertname or check_name")
+	assert.Contains(t, problems[4].Error(), "panels 1: invalid panel_id -1")
+}
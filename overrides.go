@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+
+	"github.com/betorvs/sensu-grafana-mutator/mutator"
+	"github.com/sensu/sensu-go/types"
+)
+
+// applyOptionsOverrides works like sensu plugin sdk configuration overrides, used when
+// the sdk doesn't read the event (batch and serve). It changes only c and returns true if any option was changed.
+func applyOptionsOverrides(c *Config, event *types.Event) (bool, error) {
+	changed := false
+	for _, opt := range configOptions(c) {
+		if opt.Path == "" {
+			continue
+		}
+		value := mutator.AnnotationOverride(event, c.Keyspace, opt.Path)
+		if value == "" {
+			continue
+		}
+		if err := setOptionValue(opt.Value, value); err != nil {
+			return changed, fmt.Errorf("annotation %s: %v", path.Join(c.Keyspace, opt.Path), err)
+		}
+		changed = true
+	}
+	return changed, nil
+}
+
+// validateDashboardSuggestedOverride rejects dashboard_file in grafana-dashboard-suggested annotation,
+// like in dashboard-suggested-add, then annotations cannot read files from mutator host
+func validateDashboardSuggestedOverride(event *types.Event) error {
+	value := mutator.AnnotationOverride(event, mutatorConfig.Keyspace, dashboardSuggestedKey)
+	if value == "" {
+		return nil
+	}
+	// invalid json is reported by mutatorConfigFromOptions
+	dashboards, _ := mutator.ParseDashboardSuggested(value)
+	for _, v := range dashboards {
+		if v.DashboardFile != "" {
+			return fmt.Errorf("annotation %s: dashboard_file is not allowed in annotations", path.Join(mutatorConfig.Keyspace, dashboardSuggestedKey))
+		}
+	}
+	return nil
+}
+
+func setOptionValue(target interface{}, value string) error {
+	switch t := target.(type) {
+	case *string:
+		*t = value
+	case *bool:
+		v, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*t = v
+	case *int:
+		v, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*t = v
+	default:
+		return fmt.Errorf("unsupported option type %T", target)
+	}
+	return nil
+}
+
+// validateEvent works like sensu plugin sdk event validation for mutators
+func validateEvent(event *types.Event) error {
+	if event.Timestamp <= 0 {
+		return fmt.Errorf("timestamp is missing or must be greater than zero")
+	}
+	return event.Validate()
+}
+
+// mutateEvent applies annotations overrides only for this event and runs the mutator.
+// Events without overrides share linkMutator and can be mutated concurrently.
+func mutateEvent(event *types.Event) (*types.Event, error) {
+	m, err := eventMutator(event)
+	if err != nil {
+		return nil, err
+	}
+	return m.Mutate(event)
+}
+
+// eventMutator returns linkMutator or, if the event has options overrides, a new mutator
+// created from a copy of all options with overrides applied. mutatorConfig is only read, then
+// events can be mutated concurrently.
+func eventMutator(event *types.Event) (*mutator.Mutator, error) {
+	if !hasOptionsOverrides(event) {
+		return linkMutator, nil
+	}
+	config := mutatorConfig
+	if _, err := applyOptionsOverrides(&config, event); err != nil {
+		return nil, err
+	}
+	// config file was loaded at startup and cannot be overridden
+	config.ConfigFile = ""
+	m, problems := buildMutator(&config, event, linkMutator)
+	if len(problems) != 0 {
+		return nil, mutator.JoinErrors(problems)
+	}
+	return m, nil
+}
+
+func hasOptionsOverrides(event *types.Event) bool {
+	for _, opt := range options {
+		if opt.Path != "" && mutator.AnnotationOverride(event, mutatorConfig.Keyspace, opt.Path) != "" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	v2 "github.com/sensu/sensu-go/api/core/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMutateEvent(t *testing.T) {
+	mutatorConfig.Name = "sensu-grafana-mutator"
+	mutatorConfig.Keyspace = "sensu.io/plugins/sensu-grafana-mutator/config"
+	mutatorConfig.GrafanaURL = "https://grafana.com/?orgId=1"
+	mutatorConfig.GrafanaExploreLinkEnabled = true
+	assert.NoError(t, checkArgs(nil))
+
+	event1 := v2.FixtureEvent("entity1", "check1")
+	event1.Check.Labels = map[string]string{"namespace": "spacename"}
+	result1, err1 := mutateEvent(event1)
+	assert.NoError(t, err1)
+	assert.Contains(t, result1.Check.Annotations, "grafana_loki_url")
+
+	// annotations overrides are only used for this event
+	event2 := v2.FixtureEvent("entity1", "check1")
+	event2.Check.Labels = map[string]string{"namespace": "spacename"}
+	event2.Check.Annotations = map[string]string{"sensu.io/plugins/sensu-grafana-mutator/config/grafana-explore-link-enabled": "false"}
+	result2, err2 := mutateEvent(event2)
+	assert.Error(t, err2)
+	assert.Nil(t, result2)
+	assert.True(t, mutatorConfig.GrafanaExploreLinkEnabled)
+
+	event3 := v2.FixtureEvent("entity1", "check1")
+	event3.Check.Labels = map[string]string{"namespace": "spacename"}
+	result3, err3 := mutateEvent(event3)
+	assert.NoError(t, err3)
+	assert.Contains(t, result3.Check.Annotations, "grafana_loki_url")
+
+	// events with and without overrides are mutated concurrently in serve command
+	timeRange := mutatorConfig.GrafanaMutatorTimeRange
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			event := v2.FixtureEvent("entity1", "check1")
+			event.Check.Labels = map[string]string{"namespace": "spacename"}
+			if i%2 == 0 {
+				event.Check.Annotations = map[string]string{"sensu.io/plugins/sensu-grafana-mutator/config/grafana-mutator-time-range": "600"}
+			}
+			result, err := mutateEvent(event)
+			assert.NoError(t, err)
+			assert.Contains(t, result.Check.Annotations, "grafana_loki_url")
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, timeRange, mutatorConfig.GrafanaMutatorTimeRange)
+
+	// config file cannot be changed by annotations, it would read any file in sensu-backend host
+	secretFile := filepath.Join(t.TempDir(), "secret.yaml")
+	assert.NoError(t, ioutil.WriteFile(secretFile, []byte("db_password: hunter2\n"), 0600))
+	event4 := v2.FixtureEvent("entity1", "check1")
+	event4.Check.Labels = map[string]string{"namespace": "spacename"}
+	event4.Entity.Annotations = map[string]string{"sensu.io/plugins/sensu-grafana-mutator/config/config-file": secretFile}
+	assert.False(t, hasOptionsOverrides(event4))
+	result4, err4 := mutateEvent(event4)
+	assert.NoError(t, err4)
+	assert.Contains(t, result4.Check.Annotations, "grafana_loki_url")
+
+	// dashboard_file cannot be used in annotations, it would read any file in sensu-backend host
+	event5 := v2.FixtureEvent("entity1", "check1")
+	event5.Check.Labels = map[string]string{"namespace": "spacename"}
+	event5.Entity.Annotations = map[string]string{"sensu.io/plugins/sensu-grafana-mutator/config/grafana-dashboard-suggested": `[{"grafana_annotation":"secrets","dashboard_file":"` + secretFile + `"}]`}
+	_, err5 := mutateEvent(event5)
+	assert.EqualError(t, err5, "annotation sensu.io/plugins/sensu-grafana-mutator/config/grafana-dashboard-suggested: dashboard_file is not allowed in annotations")
+	assert.EqualError(t, checkArgs(event5), "annotation sensu.io/plugins/sensu-grafana-mutator/config/grafana-dashboard-suggested: dashboard_file is not allowed in annotations")
+
+	mutatorConfig.GrafanaURL = ""
+	mutatorConfig.GrafanaExploreLinkEnabled = false
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/betorvs/sensu-grafana-mutator/mutator"
+	"github.com/sensu-community/sensu-plugin-sdk/sensu"
+	"github.com/sensu/sensu-go/types"
+)
+
+const (
+	// maxEventSize limits the request body in serve command
+	maxEventSize = 1 << 20
+	// shutdownTimeout is the time to wait for requests in progress after SIGINT or SIGTERM
+	shutdownTimeout = 30 * time.Second
+)
+
+// linksResponse is returned by POST /links
+type linksResponse struct {
+	Links  map[string]string   `json:"links"`
+	Errors []mutator.LinkError `json:"errors"`
+}
+
+// errorResponse is returned for any request with error
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// serveCommand runs sensu-grafana-mutator serve, an HTTP server using the same flags and
+// environment variables. Configuration is parsed once at startup.
+func serveCommand() {
+	serve := sensu.NewGoCheck(&mutatorConfig.PluginConfig, options, checkServeArgs, executeServe, false)
+	serve.Execute()
+}
+
+func checkServeArgs(_ *types.Event) (int, error) {
+	if err := checkArgs(nil); err != nil {
+		return sensu.CheckStateUnknown, err
+	}
+	if mutatorConfig.ServeRequestTimeout <= 0 {
+		return sensu.CheckStateUnknown, fmt.Errorf("--serve-request-timeout should be greater than zero")
+	}
+	return sensu.CheckStateOK, nil
+}
+
+// executeServe runs the HTTP server until SIGINT or SIGTERM, then waits for requests in progress
+func executeServe(_ *types.Event) (int, error) {
+	timeout := time.Duration(mutatorConfig.ServeRequestTimeout) * time.Second
+	server := &http.Server{
+		Addr:         mutatorConfig.ServeAddress,
+		Handler:      http.TimeoutHandler(newServeMux(), timeout, `{"error":"request timeout"}`),
+		ReadTimeout:  timeout,
+		WriteTimeout: timeout + time.Second,
+	}
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	serverErr := make(chan error, 1)
+	go func() {
+		log.Printf("listening on %s", mutatorConfig.ServeAddress)
+		serverErr <- server.ListenAndServe()
+	}()
+	select {
+	case err := <-serverErr:
+		return sensu.CheckStateCritical, err
+	case sig := <-stop:
+		log.Printf("received %v, shutting down", sig)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		return sensu.CheckStateCritical, err
+	}
+	return sensu.CheckStateOK, nil
+}
+
+// newServeMux returns all serve command endpoints: POST /mutate returns the mutated event,
+// POST /links returns only links and errors, GET /healthz and GET /metrics
+func newServeMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "only GET is allowed"})
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		mutatorMetrics.write(w)
+	})
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "only GET is allowed"})
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+	mux.HandleFunc("/mutate", func(w http.ResponseWriter, r *http.Request) {
+		event, status, err := mutateRequest(w, r)
+		if err != nil {
+			writeJSON(w, status, errorResponse{Error: err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, event)
+	})
+	mux.HandleFunc("/links", func(w http.ResponseWriter, r *http.Request) {
+		links, status, err := linksRequest(w, r)
+		if err != nil {
+			writeJSON(w, status, errorResponse{Error: err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, links)
+	})
+	return mux
+}
+
+// readEvent reads and validates one event from request body, it returns an HTTP status for errors.
+// Bodies bigger than maxEventSize return 413 and the connection is closed after the response.
+func readEvent(w http.ResponseWriter, r *http.Request) (*types.Event, int, error) {
+	if r.Method != http.MethodPost {
+		return nil, http.StatusMethodNotAllowed, fmt.Errorf("only POST is allowed")
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxEventSize))
+	if err != nil {
+		return nil, http.StatusRequestEntityTooLarge, err
+	}
+	start := time.Now()
+	event := &types.Event{}
+	if err := json.Unmarshal(body, event); err != nil {
+		mutatorMetrics.observeEvent("invalid", time.Since(start))
+		return nil, http.StatusBadRequest, fmt.Errorf("invalid event %v", err)
+	}
+	if err := validateEvent(event); err != nil {
+		mutatorMetrics.observeEvent("invalid", time.Since(start))
+		return nil, http.StatusBadRequest, fmt.Errorf("invalid event %v", err)
+	}
+	return event, http.StatusOK, nil
+}
+
+// mutateRequest reads one event from request body and mutates it.
+// It returns the event, if it was mutated, and an HTTP status for errors.
+func mutateRequest(w http.ResponseWriter, r *http.Request) (*types.Event, int, error) {
+	event, status, err := readEvent(w, r)
+	if err != nil {
+		return nil, status, err
+	}
+	start := time.Now()
+	mutated, err := mutateEvent(event)
+	observeMutation(start, err)
+	if err != nil {
+		return mutated, http.StatusUnprocessableEntity, err
+	}
+	return mutated, http.StatusOK, nil
+}
+
+// linksRequest reads one event from request body and returns all links created by the mutator used for this
+// event, even if the event already has the same annotations. Links ignore --always-return-event, all
+// link errors are returned with the links created.
+func linksRequest(w http.ResponseWriter, r *http.Request) (linksResponse, int, error) {
+	event, status, err := readEvent(w, r)
+	if err != nil {
+		return linksResponse{}, status, err
+	}
+	start := time.Now()
+	response, err := eventLinksResponse(event)
+	observeMutation(start, err)
+	if err != nil {
+		return linksResponse{}, http.StatusUnprocessableEntity, err
+	}
+	return response, http.StatusOK, nil
+}
+
+// eventLinksResponse calls Links in the mutator used for event
+func eventLinksResponse(event *types.Event) (linksResponse, error) {
+	if event.Check == nil {
+		return linksResponse{}, fmt.Errorf("event without check cannot be mutated")
+	}
+	m, err := eventMutator(event)
+	if err != nil {
+		return linksResponse{}, err
+	}
+	links, err := m.Links(event)
+	response := linksResponse{Links: make(map[string]string), Errors: []mutator.LinkError{}}
+	for _, link := range links {
+		response.Links[link.Name] = link.URL
+	}
+	if linkErrors, ok := err.(mutator.LinkErrors); ok {
+		response.Errors = linkErrors
+	}
+	return response, nil
+}
+
+// observeMutation counts one event mutated or failed
+func observeMutation(start time.Time, err error) {
+	if err != nil {
+		mutatorMetrics.observeError("mutation")
+		mutatorMetrics.observeEvent("failed", time.Since(start))
+		return
+	}
+	mutatorMetrics.observeEvent("mutated", time.Since(start))
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("failed writing response %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServeMux(t *testing.T) {
+	mutatorConfig.Name = "sensu-grafana-mutator"
+	mutatorConfig.GrafanaURL = "https://grafana.com/?orgId=1"
+	mutatorConfig.GrafanaExploreLinkEnabled = true
+	mutatorConfig.GrafanaDashboardSuggested = `[{"grafana_annotation":"nodes","dashboard_url":"https://grafana.com/d/nodes?orgId=1","labels":["namespace"]}]`
+	mutatorMetrics = newMetrics()
+	assert.NoError(t, checkArgs(nil))
+	server := httptest.NewServer(newServeMux())
+	defer server.Close()
+
+	res1, err1 := http.Get(server.URL + "/healthz")
+	assert.NoError(t, err1)
+	assert.Equal(t, http.StatusOK, res1.StatusCode)
+	res1.Body.Close()
+
+	event := `{"timestamp":1606487400,"entity":{"entity_class":"agent","metadata":{"name":"entity1","namespace":"default"}},"check":{"interval":60,"metadata":{"name":"check1","namespace":"default","labels":{"namespace":"spacename"}}}}`
+	res2, err2 := http.Post(server.URL+"/links", "application/json", strings.NewReader(event))
+	assert.NoError(t, err2)
+	assert.Equal(t, http.StatusOK, res2.StatusCode)
+	links := linksResponse{}
+	assert.NoError(t, json.NewDecoder(res2.Body).Decode(&links))
+	res2.Body.Close()
+	assert.Contains(t, links.Links["grafana_loki_url"], "https://grafana.com/explore?orgId=1")
+	assert.Contains(t, links.Links["grafana_nodes_url"], "&var-namespace=spacename")
+	assert.Empty(t, links.Errors)
+
+	// links already found in event annotations are returned too
+	event2 := strings.Replace(event, `"name":"check1",`, `"name":"check1","annotations":{"grafana_loki_url":"https://old.com"},`, 1)
+	res7, err7 := http.Post(server.URL+"/links", "application/json", strings.NewReader(event2))
+	assert.NoError(t, err7)
+	links2 := linksResponse{}
+	assert.NoError(t, json.NewDecoder(res7.Body).Decode(&links2))
+	res7.Body.Close()
+	assert.Contains(t, links2.Links["grafana_loki_url"], "https://grafana.com/explore?orgId=1")
+
+	res3, err3 := http.Post(server.URL+"/mutate", "application/json", strings.NewReader(`{"timestamp":0}`))
+	assert.NoError(t, err3)
+	assert.Equal(t, http.StatusBadRequest, res3.StatusCode)
+	res3.Body.Close()
+
+	tooLarge := `{"timestamp":1606487400,"check":{"output":"` + strings.Repeat("x", maxEventSize) + `"}}`
+	res6, err6 := http.Post(server.URL+"/mutate", "application/json", strings.NewReader(tooLarge))
+	assert.NoError(t, err6)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, res6.StatusCode)
+	res6.Body.Close()
+
+	res5, err5 := http.Get(server.URL + "/metrics")
+	assert.NoError(t, err5)
+	metricsBody, _ := ioutil.ReadAll(res5.Body)
+	res5.Body.Close()
+	assert.Contains(t, string(metricsBody), `sensu_grafana_mutator_events_total{result="mutated"} 2`)
+	assert.Contains(t, string(metricsBody), `sensu_grafana_mutator_events_total{result="invalid"} 1`)
+	assert.Contains(t, string(metricsBody), `sensu_grafana_mutator_rule_matches_total{rule="grafana_nodes_url",result="match"} 2`)
+	assert.Contains(t, string(metricsBody), `sensu_grafana_mutator_links_total{rule="grafana_nodes_url"} 2`)
+
+	res4, err4 := http.Get(server.URL + "/links")
+	assert.NoError(t, err4)
+	assert.Equal(t, http.StatusMethodNotAllowed, res4.StatusCode)
+	res4.Body.Close()
+
+	mutatorConfig.GrafanaURL = ""
+	mutatorConfig.GrafanaExploreLinkEnabled = false
+	mutatorConfig.GrafanaDashboardSuggested = ""
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/betorvs/sensu-grafana-mutator/mutator"
+	"github.com/sensu-community/sensu-plugin-sdk/sensu"
+	"github.com/sensu/sensu-go/types"
+)
+
+// buildMutator loads --config-file into c, parses all options and creates a mutator, using base.WithConfig
+// if base is not nil. Annotations in event (can be nil) have precedence over config file, like flags and
+// environment variables. It doesn't stop in the first problem, all problems found are returned.
+func buildMutator(c *Config, event *types.Event, base *mutator.Mutator) (*mutator.Mutator, []error) {
+	if c.ConfigFile != "" {
+		if err := loadConfigFile(c, c.ConfigFile, explicitOptions(os.Args[1:], event)); err != nil {
+			return nil, []error{err}
+		}
+	}
+	if event != nil {
+		if err := validateDashboardSuggestedOverride(event); err != nil {
+			return nil, []error{err}
+		}
+	}
+	config, problems := mutatorConfigFromOptions(*c)
+	// sensu plugin sdk applies event annotations before checkArgs, grafana API token is only sent to
+	// grafana instances set at startup
+	if event != nil && base == nil {
+		config.GrafanaAPIURLs = grafanaAPIURLs(startupConfig(os.Args[1:]))
+	}
+	newMutator := mutator.New
+	if base != nil {
+		newMutator = base.WithConfig
+	}
+	m, err := newMutator(config)
+	if configProblems, ok := err.(mutator.Problems); ok {
+		problems = append(problems, configProblems...)
+	} else if err != nil {
+		problems = append(problems, err)
+	}
+	if len(problems) != 0 {
+		return nil, problems
+	}
+	return m, nil
+}
+
+// grafanaAPIURLs returns --grafana-url and --grafana-instances URLs
+func grafanaAPIURLs(c Config) []string {
+	urls := []string{c.GrafanaURL}
+	instances, _ := mutator.ParseGrafanaInstances(c.GrafanaInstances)
+	for _, instance := range instances {
+		urls = append(urls, instance.GrafanaURL)
+	}
+	return urls
+}
+
+// mutatorConfigFromOptions converts command line flags, environment variables and config file into mutator.Config
+func mutatorConfigFromOptions(c Config) (mutator.Config, []error) {
+	problems := []error{}
+	grafanaInstances, err := mutator.ParseGrafanaInstances(c.GrafanaInstances)
+	if err != nil {
+		problems = append(problems, fmt.Errorf("invalid --grafana-instances %v", err))
+	}
+	dashboardSuggested, err := mutator.ParseDashboardSuggested(c.GrafanaDashboardSuggested)
+	if err != nil {
+		problems = append(problems, fmt.Errorf("invalid --grafana-dashboard-suggested %v", err))
+	}
+	config := mutator.Config{
+		Name:                            c.Name,
+		Keyspace:                        c.Keyspace,
+		GrafanaURL:                      c.GrafanaURL,
+		GrafanaInstances:                grafanaInstances,
+		GrafanaDashboardSuggested:       dashboardSuggested,
+		GrafanaAPIToken:                 c.GrafanaAPIToken,
+		GrafanaAPICacheFile:             c.GrafanaAPICacheFile,
+		GrafanaAPICacheTTL:              time.Duration(c.GrafanaAPICacheTTL) * time.Second,
+		GrafanaDashboardsDir:            c.GrafanaDashboardsDir,
+		GrafanaDashboardsTag:            c.GrafanaDashboardsTag,
+		GrafanaRenderImages:             c.GrafanaRenderImages,
+		GrafanaRenderWidth:              c.GrafanaRenderWidth,
+		GrafanaRenderHeight:             c.GrafanaRenderHeight,
+		GrafanaRenderTheme:              c.GrafanaRenderTheme,
+		GrafanaRenderTimezone:           c.GrafanaRenderTimezone,
+		GrafanaExploreLinkEnabled:       c.GrafanaExploreLinkEnabled,
+		GrafanaLokiDatasource:           c.GrafanaLokiDatasource,
+		GrafanaExploreURLVersion:        c.GrafanaExploreURLVersion,
+		GrafanaExploreSplitEnabled:      c.GrafanaExploreSplitEnabled,
+		GrafanaExploreSplitPanes:        stringToSliceStrings(c.GrafanaExploreSplitPanes),
+		GrafanaPrometheusLinkEnabled:    c.GrafanaPrometheusLinkEnabled,
+		GrafanaPrometheusDatasource:     c.GrafanaPrometheusDatasource,
+		GrafanaPrometheusMetric:         c.GrafanaPrometheusMetric,
+		GrafanaTempoLinkEnabled:         c.GrafanaTempoLinkEnabled,
+		GrafanaTempoDatasource:          c.GrafanaTempoDatasource,
+		TempoTraceIDLabel:               c.TempoTraceIDLabel,
+		TempoTraceIDRegex:               c.TempoTraceIDRegex,
+		SensuLabelSelector:              c.SensuLabelSelector,
+		KubernetesIntegrationLabel:      c.KubernetesIntegrationLabel,
+		KubernetesEventsIntegration:     c.KubernetesEventsIntegration,
+		KubernetesEventsStreamLabel:     c.KubernetesEventsStreamLabel,
+		KubernetesEventsStreamSelector:  c.KubernetesEventsStreamSelector,
+		KubernetesEventsPipeline:        c.KubernetesEventsPipeline,
+		KubernetesEventsStreamNamespace: c.KubernetesEventsStreamNamespace,
+		AlertmanagerEventsIntegration:   c.AlertmanagerEventsIntegration,
+		AlertmanagerIntegrationLabel:    c.AlertmanagerIntegrationLabel,
+		DefaultLokiLabelNamespace:       c.DefaultLokiLabelNamespace,
+		DefaultLokiLabelHostname:        c.DefaultLokiLabelHostname,
+		DefaultIntegrationsLabelNode:    c.DefaultIntegrationsLabelNode,
+		ExtraLokiLabels:                 stringToSliceStrings(c.ExtraLokiLabels),
+		LokiStreamMatchers:              c.LokiStreamMatchers,
+		AlwaysReturnEvent:               c.AlwaysReturnEvent,
+		TimeRange:                       time.Duration(c.GrafanaMutatorTimeRange) * time.Second,
+		RuleObserver:                    mutatorMetrics.observeRule,
+		LinkObserver:                    mutatorMetrics.observeLink,
+	}
+	return config, problems
+}
+
+// validateCommand runs sensu-grafana-mutator validate, useful in CI, using the same flags and environment variables
+func validateCommand() {
+	validate := sensu.NewGoCheck(&mutatorConfig.PluginConfig, options, checkValidateArgs, executeValidate, false)
+	validate.Execute()
+}
+
+func checkValidateArgs(_ *types.Event) (int, error) {
+	return sensu.CheckStateOK, nil
+}
+
+// executeValidate prints all problems found and exits with 2 if there is any
+func executeValidate(_ *types.Event) (int, error) {
+	_, problems := buildMutator(&mutatorConfig, nil, nil)
+	if len(problems) == 0 {
+		fmt.Fprintln(os.Stdout, "configuration is valid")
+		return sensu.CheckStateOK, nil
+	}
+	fmt.Fprintf(os.Stdout, "found %d problems in configuration:\n", len(problems))
+	for _, p := range problems {
+		fmt.Fprintf(os.Stdout, "- %v\n", p)
+	}
+	return sensu.CheckStateCritical, nil
+}
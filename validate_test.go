@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildMutator(t *testing.T) {
+	mutatorConfig.GrafanaURL = "https://grafana.com/?orgId=1"
+	mutatorConfig.GrafanaExploreLinkEnabled = true
+	mutatorConfig.GrafanaDashboardSuggested = `[{"grafana_annotation":"nodes","dashboard_url":"https://grafana.com/d/nodes?orgId=1","labels":["cluster"]}]`
+	m, problems1 := buildMutator(&mutatorConfig, nil, nil)
+	assert.Empty(t, problems1)
+	assert.Equal(t, 1, len(m.Config().GrafanaDashboardSuggested))
+
+	mutatorConfig.GrafanaExploreURLVersion = "v3"
+	mutatorConfig.LokiStreamMatchers = "namespace"
+	mutatorConfig.GrafanaDashboardSuggested = `[{"grafana_annotation":"nodes","dashboard_url":"https://grafana.com/d/nodes"},{"grafana_annotation":"Nodes","dashboard_url":"https://grafana.com/d/nodes?orgId=1","labels":[]}]`
+	_, problems2 := buildMutator(&mutatorConfig, nil, nil)
+	assert.Equal(t, 5, len(problems2))
+	assert.Error(t, checkArgs(nil))
+
+	mutatorConfig.GrafanaExploreURLVersion = ""
+	mutatorConfig.LokiStreamMatchers = ""
+	mutatorConfig.GrafanaDashboardSuggested = `[{"grafana_annotation":"nodes","dashboard_uri":"https://grafana.com/d/nodes?orgId=1"}]`
+	_, problems3 := buildMutator(&mutatorConfig, nil, nil)
+	assert.Equal(t, 1, len(problems3))
+	assert.Contains(t, problems3[0].Error(), "dashboard_uri")
+
+	mutatorConfig.GrafanaURL = ""
+	mutatorConfig.GrafanaExploreLinkEnabled = false
+	mutatorConfig.GrafanaDashboardSuggested = ""
+}